@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+)
+
+/*
+Asynchronous foreign procedures run in a goroutine of their own, so a call
+that blocks on a disk, a subprocess or a timer does not hold up the rest of
+the run. Executing one only starts the call: the process commits straight
+away without binding anything. When the call returns, its outputs are bound
+as if by that process and whoever suspended on them wakes up; if it fails,
+so does the process. While calls are outstanding the run is live, however
+empty the pool, so it is not mistaken for a deadlock.
+
+How results get back in is up to the scheduler, which sets an asyncHost for
+the duration of the run; the debugger sets one too. Without one, calls run
+inline, except for timer, which fails instead of holding everything up.
+*/
+
+type asyncHost interface {
+	// started is called under the scheduler's write lock when a call starts
+	started()
+	// finished is called from the goroutine of the call once it returns
+	finished(r asyncResult)
+}
+
+type asyncResult struct {
+	// the process that made the call
+	p process
+	// returns the bindings the result makes, or false if p fails;
+	// called under the write lock
+	outputs func(i *Interpreter) (bindings, bool)
+	// more results are coming from the same source, see FeedStream
+	more bool
+}
+
+// beginRun is called by a scheduler before it spawns the goal, holding the
+// write lock if it has one; it makes host take the results of async calls
+// and starts feeding streams
+func (i *Interpreter) beginRun(host asyncHost) {
+	i.async = host
+	for _, feed := range i.feeds {
+		feed()
+	}
+	i.feeds = nil
+}
+
+// endRun is called by a scheduler once the run is over
+func (i *Interpreter) endRun() {
+	i.async = nil
+	// nothing more is going to be bound
+	for _, ws := range i.watchers {
+		for _, w := range ws {
+			w.q.close()
+		}
+	}
+	i.watchers = nil
+	i.closeFiles()
+}
+
+// RegisterAsyncForeign is RegisterForeign for procedures that may block
+func RegisterAsyncForeign(name string, modes []Mode, fn ForeignFunc) error {
+	return registerForeign(name, modes, fn, true)
+}
+
+func MustRegisterAsyncForeign(name string, modes []Mode, fn ForeignFunc) {
+	if err := RegisterAsyncForeign(name, modes, fn); err != nil {
+		panic(err)
+	}
+}
+
+// only call while holding the write lock
+func (i *Interpreter) startAsync(p process, modes []Mode, fn ForeignFunc, in []any) {
+	host := i.async
+	host.started()
+	go func() {
+		out, err := fn(in)
+		host.finished(asyncResult{p: p, outputs: func(i *Interpreter) (bindings, bool) {
+			return i.foreignOutputs(i.bindings, p, modes, out, err)
+		}})
+	}()
+}
+
+// asyncOutputs returns the bindings r makes, or false if its process failed;
+// only call while holding the write lock
+func (i *Interpreter) asyncOutputs(r asyncResult) (bindings, bool) {
+	i.recordChoice(choice{Process: r.p.id, Outcome: asyncOutcome})
+	theta, ok := r.outputs(i)
+	if !ok {
+		i.failed = append(i.failed, stuckProcess{p: r.p})
+	}
+	return theta, ok
+}
+
+// the host for interpretSinglethreaded: results are handed
+// to the interpreter loop, which applies them between steps
+type loopAsync struct {
+	pending int
+	done    chan asyncResult
+	// closed when the run is interrupted: nobody takes results anymore
+	halt <-chan struct{}
+	// results received out of turn when replaying, by process id
+	early    map[uint64][]asyncResult
+	numEarly int
+}
+
+func (a *loopAsync) started() {
+	a.pending++
+}
+
+func (a *loopAsync) finished(r asyncResult) {
+	select {
+	case a.done <- r:
+	case <-a.halt:
+	}
+}
+
+// apply applies the result of one finished call, waiting for one if wait is
+// set; returns false if there was nothing to apply, or nothing to wait for
+func (a *loopAsync) apply(i *Interpreter, wait bool) bool {
+	if a.pending == 0 {
+		return false
+	}
+	var r asyncResult
+	if wait {
+		select {
+		case r = <-a.done:
+		case <-a.halt:
+			return false
+		}
+	} else {
+		select {
+		case r = <-a.done:
+		default:
+			return false
+		}
+	}
+	a.commit(i, r)
+	return true
+}
+
+// applyFor applies the result of the call made by process id, waiting for it
+// and holding on to results of other calls until their turn comes
+func (a *loopAsync) applyFor(i *Interpreter, id uint64) {
+	for {
+		if rs := a.early[id]; len(rs) > 0 {
+			a.early[id] = rs[1:]
+			a.numEarly--
+			a.commit(i, rs[0])
+			return
+		}
+		if a.pending == a.numEarly {
+			r := i.replayer
+			r.err = fmt.Errorf("replay diverged at step %d: process %d has no async call outstanding", r.choices[r.next].Step, id)
+			return
+		}
+		var r asyncResult
+		select {
+		case r = <-a.done:
+		case <-a.halt:
+			return
+		}
+		a.early[r.p.id] = append(a.early[r.p.id], r)
+		a.numEarly++
+	}
+}
+
+func (a *loopAsync) commit(i *Interpreter, r asyncResult) {
+	if !r.more {
+		a.pending--
+	}
+	if theta, ok := i.asyncOutputs(r); ok {
+		i.commitBindings(r.p, i.bindings, theta)
+	}
+}
+
+// drain waits for outstanding calls, ignoring their results
+func (a *loopAsync) drain() {
+	for _, rs := range a.early {
+		for _, r := range rs {
+			if !r.more {
+				a.pending--
+			}
+		}
+	}
+	for a.pending > 0 {
+		select {
+		case r := <-a.done:
+			if !r.more {
+				a.pending--
+			}
+		case <-a.halt:
+			return
+		}
+	}
+}
+
+// the host for interpretWorkStealing: an outstanding call counts as active
+type stealAsync struct {
+	s *stealScheduler
+}
+
+func (a stealAsync) started() {
+	a.s.active.Add(1)
+}
+
+func (a stealAsync) finished(r asyncResult) {
+	s := a.s
+	s.mu.Lock()
+	if s.over || s.i.interrupted() {
+		// the bindings may be the caller's by now
+		s.mu.Unlock()
+		return
+	}
+	if theta, ok := s.i.asyncOutputs(r); ok {
+		for _, q := range s.i.bind(0, r.p, s.i.bindings, theta) {
+			s.push(0, q)
+		}
+	}
+	s.mu.Unlock()
+	if r.more {
+		return
+	}
+	// anything woken has been pushed already
+	s.done()
+}
+
+// the host for interpretGoroutines: an outstanding call counts as live
+type futureAsync struct {
+	f *futureRun
+}
+
+func (a futureAsync) started() {
+	a.f.live++
+	a.f.i.stats.poolDelta(1)
+}
+
+func (a futureAsync) finished(r asyncResult) {
+	f := a.f
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.over || f.i.interrupted() {
+		// the bindings may be the caller's by now
+		return
+	}
+	if theta, ok := f.i.asyncOutputs(r); ok {
+		f.bind(r.p, theta)
+	}
+	if !r.more {
+		f.exit()
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// calls to rendezvous/2 only return once all of the group are in flight
+var rendezvousGroup *sync.WaitGroup
+
+func init() {
+	// rendezvous(X, Y)   % Y is X, once everyone else has called too
+	MustRegisterAsyncForeign("rendezvous", []Mode{In, Out}, func(in []any) ([]any, error) {
+		wg := rendezvousGroup
+		wg.Done()
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			return nil, fmt.Errorf("calls did not run concurrently")
+		}
+		return []any{in[0]}, nil
+	})
+	// slow_fail(X)   % fails after a while
+	MustRegisterAsyncForeign("slow_fail", []Mode{In}, func(in []any) ([]any, error) {
+		time.Sleep(time.Millisecond)
+		return nil, fmt.Errorf("gave up on %v", in[0])
+	})
+}
+
+var asyncProgram = MustParseRules(`
+    go(R) :- rendezvous(1, A), rendezvous(2, B), rendezvous(3, C), sum1([A,B,C], 0, R).
+    sum1([X|Xs], A, R) :- isplus(A1, A, X), sum1(Xs, A1, R).
+    sum1([], A, R) :- R := A.`)
+
+func TestAsyncForeign(t *testing.T) {
+	for name, interpret := range schedulers {
+		for _, e := range engines {
+			// while the calls wait for each other, all that is
+			// left is suspended: that is not a deadlock
+			rendezvousGroup = &sync.WaitGroup{}
+			rendezvousGroup.Add(3)
+			i := NewInterpreter(asyncProgram, 2)
+			i.engine = e
+			q, b := i.MustParseProcesses("go(R)")
+			res, deadlocked, _ := interpret(i, q)
+			if deadlocked {
+				t.Fatalf("%s engine %d: deadlocked!\n%s", name, e, i.Report())
+			}
+			if got := walk(res, b["R"]); got != number(6) {
+				t.Errorf("%s engine %d: expected 6 but got %s\n%s", name, e, got.PrintExpression(), i.Report())
+			}
+		}
+	}
+}
+
+func TestAsyncForeignFailure(t *testing.T) {
+	i := NewSingleThreadedInterpreter(nil)
+	q, _ := i.MustParseProcesses("slow_fail(7)")
+	if _, deadlocked, _ := i.interpretSinglethreaded(q); deadlocked {
+		t.Fatal("deadlocked!")
+	}
+	if got := i.Report(); got != "failed: #1 slow_fail(7): gave up on 7\n" {
+		t.Errorf("expected the error in the report but got\n%s", got)
+	}
+}
+
+func TestAsyncReplay(t *testing.T) {
+	var log bytes.Buffer
+	rendezvousGroup = &sync.WaitGroup{}
+	rendezvousGroup.Add(3)
+	i := NewInterpreter(asyncProgram, 4)
+	i.Record(&log)
+	q, _ := i.MustParseProcesses("go(R)")
+	if _, deadlocked, _ := i.interpretWorkStealing(q); deadlocked {
+		t.Fatal("deadlocked!")
+	}
+	choices, err := readChoices(&log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendezvousGroup = &sync.WaitGroup{}
+	rendezvousGroup.Add(3)
+	i = NewSingleThreadedInterpreter(asyncProgram)
+	q, b := i.MustParseProcesses("go(R)")
+	res, _, _, err := i.interpretReplay(q, choices)
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if got := walk(res, b["R"]); got != number(6) {
+		t.Errorf("expected 6 but got %s", got.PrintExpression())
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Builtins are looked up by functor and arity in a registry, instead of being
+a fixed set. Each one is a Go function that executes a process directly:
+given the bindings, it returns updates, processes to continue with, whether
+it succeeded, and which vars to suspend on if it could not proceed yet.
+Builtins always run under the scheduler's write lock, so they can touch
+interpreter state such as the lazy streams.
+Most builtins are easier written as foreign procedures, see foreign.go,
+which take care of suspending and binding; the ones here need more control.
+Programs cannot define rules for a builtin: ParseRules rejects them.
+*/
+
+type builtinFunc func(i *Interpreter, b bindings, p process) (bindings, []process, bool, []variable)
+
+var builtins = map[procKey]builtinFunc{
+	{":=", 2}:           builtinAssign,
+	{"write", 1}:        builtinWrite,
+	{"writeln", 1}:      builtinWrite,
+	{"nl", 0}:           builtinNl,
+	{"print_stream", 1}: builtinPrintStream,
+	{"read_lines", 2}:   builtinRead,
+	{"read_chars", 2}:   builtinRead,
+	{"write_lines", 2}:  builtinWriteLines,
+	{"timer", 2}:        builtinTimer,
+	{"now", 1}:          builtinNow,
+	{"merge", 3}:        builtinMerge,
+	{"merge", 2}:        builtinMerge,
+	{"open_port", 2}:    builtinOpenPort,
+	{"send", 2}:         builtinSend,
+}
+
+// guards builtins, which foreign procedures may be added to at any time
+var builtinsMu sync.RWMutex
+
+func lookupBuiltin(k procKey) (builtinFunc, bool) {
+	builtinsMu.RLock()
+	defer builtinsMu.RUnlock()
+	f, ok := builtins[k]
+	return f, ok
+}
+
+// the most extra arguments call takes
+const maxCallArgs = 7
+
+func init() {
+	for n := 0; n <= maxCallArgs; n++ {
+		builtins[procKey{"call", n + 1}] = builtinCall
+	}
+	// isplus(X,Y,Z)    % X is Y + Z
+	MustRegisterForeign("isplus", []Mode{Out, In, In}, func(in []any) ([]any, error) {
+		y, yok := in[0].(int64)
+		z, zok := in[1].(int64)
+		if !yok || !zok {
+			return nil, fmt.Errorf("expected numbers")
+		}
+		return []any{y + z}, nil
+	})
+}
+
+// X := Y   % assign Y to X in global bindings
+func builtinAssign(i *Interpreter, b bindings, p process) (bindings, []process, bool, []variable) {
+	// todo: validation, occurs checks, etc..
+	x := walk(b, p.args[0])
+	xvar, ok := x.(variable)
+	if !ok {
+		panic(fmt.Sprintf("expected variable but got %s", x.PrintExpression()))
+	}
+	return bindings{xvar: walk(b, p.args[1])}, nil, true, nil
+}
+
+// write(X)   % print X once it is fully bound
+func builtinWrite(i *Interpreter, b bindings, p process) (bindings, []process, bool, []variable) {
+	x := walkDeep(b, p.args[0])
+	if vars := unboundIn(x, nil); len(vars) > 0 {
+		return nil, nil, false, vars
+	}
+	s := display(b, x)
+	if p.functor == "writeln" {
+		s += "\n"
+	}
+	i.write(s)
+	return bindings{}, nil, true, nil
+}
+
+func builtinNl(i *Interpreter, b bindings, p process) (bindings, []process, bool, []variable) {
+	i.write("\n")
+	return bindings{}, nil, true, nil
+}
+
+// print_stream(S)   % print each element of stream S on a line of its own
+// prints as much as is available, then continues on the rest
+func builtinPrintStream(i *Interpreter, b bindings, p process) (bindings, []process, bool, []variable) {
+	s := walk(b, p.args[0])
+	var sb strings.Builder
+	for {
+		l, ok := s.(list)
+		if !ok {
+			break
+		}
+		head := walkDeep(b, l.head)
+		if len(unboundIn(head, nil)) > 0 {
+			break
+		}
+		sb.WriteString(display(b, head))
+		sb.WriteString("\n")
+		s = walk(b, l.tail)
+	}
+	i.write(sb.String())
+	switch t := s.(type) {
+	case variable:
+		if sb.Len() == 0 {
+			return nil, nil, false, []variable{t}
+		}
+	case list:
+		if sb.Len() == 0 {
+			return nil, nil, false, unboundIn(walkDeep(b, t.head), nil)
+		}
+	default:
+		if t != emptylist {
+			// not a stream
+			return nil, nil, false, nil
+		}
+		return bindings{}, nil, true, nil
+	}
+	return bindings{}, []process{{functor: "print_stream", args: []expression{s}}}, true, nil
+}
+
+// read_lines(File, S)   % S is the stream of lines in File, read lazily
+// read_chars(File, S)   % the same, but character codes
+func builtinRead(i *Interpreter, b bindings, p process) (bindings, []process, bool, []variable) {
+	file := walk(b, p.args[0])
+	if fvar, ok := file.(variable); ok {
+		return nil, nil, false, []variable{fvar}
+	}
+	s, ok := walk(b, p.args[1]).(variable)
+	if !ok {
+		i.errs[p.id] = fmt.Errorf("expected variable but got %s", walkDeep(b, p.args[1]).PrintExpression())
+		return nil, nil, false, nil
+	}
+	if err := i.openStream(p, file, s, p.functor == "read_lines"); err != nil {
+		i.errs[p.id] = err
+		return nil, nil, false, nil
+	}
+	// consumers may have suspended on S already, so nobody
+	// would ask for the first element: read it now
+	_, theta := i.demand([]variable{s})
+	return theta, nil, true, nil
+}
+
+// write_lines(File, S)   % write each element of S on a line of its own
+func builtinWriteLines(i *Interpreter, b bindings, p process) (bindings, []process, bool, []variable) {
+	file := walk(b, p.args[0])
+	if fvar, ok := file.(variable); ok {
+		return nil, nil, false, []variable{fvar}
+	}
+	s := walk(b, p.args[1])
+	if svar, ok := s.(variable); ok {
+		return nil, nil, false, []variable{svar}
+	}
+	rest, err := i.writeLines(b, file, s)
+	if err != nil {
+		i.errs[p.id] = err
+		return nil, nil, false, nil
+	}
+	switch t := rest.(type) {
+	case variable:
+	case list:
+		if rest == s {
+			return nil, nil, false, unboundIn(walkDeep(b, t.head), nil)
+		}
+	default:
+		if t != emptylist {
+			// not a stream
+			return nil, nil, false, nil
+		}
+		return bindings{}, nil, true, nil
+	}
+	return bindings{}, []process{{functor: "write_lines", args: []expression{file, rest}}}, true, nil
+}
+
+// timer(Ms, Done)   % Done := true once Ms milliseconds have passed
+// runs like an async foreign procedure, so nobody waits for it but Done
+func builtinTimer(i *Interpreter, b bindings, p process) (bindings, []process, bool, []variable) {
+	ms := walk(b, p.args[0])
+	if v, ok := ms.(variable); ok {
+		return nil, nil, false, []variable{v}
+	}
+	n, ok := ms.(number)
+	if !ok {
+		i.errs[p.id] = fmt.Errorf("expected a number of milliseconds but got %s", walkDeep(b, ms).PrintExpression())
+		return nil, nil, false, nil
+	}
+	if i.async == nil {
+		// waiting here would hold up everything, or forever on a fake clock
+		i.errs[p.id] = fmt.Errorf("timer needs a scheduler that runs async calls")
+		return nil, nil, false, nil
+	}
+	clock := i.clock
+	wait := func(in []any) ([]any, error) {
+		<-clock.After(time.Duration(n) * time.Millisecond)
+		return []any{true}, nil
+	}
+	i.startAsync(p, []Mode{In, Out}, wait, nil)
+	return bindings{}, nil, true, nil
+}
+
+// now(T)   % T is the time in milliseconds since the Unix epoch
+func builtinNow(i *Interpreter, b bindings, p process) (bindings, []process, bool, []variable) {
+	t, ok := i.clockTime(p)
+	if !ok {
+		return nil, nil, false, nil
+	}
+	theta, ok := i.foreignOutputs(b, p, []Mode{Out}, []any{t}, nil)
+	return theta, nil, ok, nil
+}
+
+// merge(Xs, Ys, Zs)   % Zs interleaves the elements of streams Xs and Ys
+// merge(Ss, Zs)       % the same for a list of streams
+// takes an element of every stream in turn, for as long as any has one,
+// then continues on the rest; suspends on all of them if none has
+func builtinMerge(i *Interpreter, b bindings, p process) (bindings, []process, bool, []variable) {
+	var streams []expression
+	if p.arity() == 3 {
+		streams = []expression{p.args[0], p.args[1]}
+	} else {
+		ss := walk(b, p.args[0])
+		for {
+			l, ok := ss.(list)
+			if !ok {
+				break
+			}
+			streams = append(streams, l.head)
+			ss = walk(b, l.tail)
+		}
+		if v, ok := ss.(variable); ok {
+			return nil, nil, false, []variable{v}
+		}
+		if ss != emptylist {
+			i.errs[p.id] = fmt.Errorf("expected a list of streams but got %s", walkDeep(b, p.args[0]).PrintExpression())
+			return nil, nil, false, nil
+		}
+	}
+	zs, ok := walk(b, p.args[len(p.args)-1]).(variable)
+	if !ok {
+		i.errs[p.id] = fmt.Errorf("expected variable but got %s", walkDeep(b, p.args[len(p.args)-1]).PrintExpression())
+		return nil, nil, false, nil
+	}
+	var out []expression
+	for taken := true; taken; {
+		taken = false
+		var rest []expression
+		for _, s := range streams {
+			switch t := walk(b, s).(type) {
+			case variable:
+				rest = append(rest, t)
+			case list:
+				out = append(out, t.head)
+				rest = append(rest, t.tail)
+				taken = true
+			default:
+				if t != emptylist {
+					i.errs[p.id] = fmt.Errorf("expected a stream but got %s", walkDeep(b, t).PrintExpression())
+					return nil, nil, false, nil
+				}
+			}
+		}
+		streams = rest
+	}
+	// whatever is left has not been bound yet
+	switch len(streams) {
+	case 0:
+		return bindings{zs: makeList(out, emptylist)}, nil, true, nil
+	case 1:
+		return bindings{zs: makeList(out, streams[0])}, nil, true, nil
+	}
+	if len(out) == 0 {
+		suspend := make([]variable, len(streams))
+		for n, s := range streams {
+			suspend[n] = s.(variable)
+		}
+		return nil, nil, false, suspend
+	}
+	tail := i.fresh()
+	next := process{functor: "merge", args: []expression{makeList(streams, emptylist), tail}}
+	if p.arity() == 3 {
+		next.args = []expression{streams[0], streams[1], tail}
+	}
+	return bindings{zs: makeList(out, tail)}, []process{next}, true, nil
+}
+
+// open_port(Port, S)   % messages sent to Port end up on stream S
+func builtinOpenPort(i *Interpreter, b bindings, p process) (bindings, []process, bool, []variable) {
+	for _, arg := range p.args {
+		if _, ok := walk(b, arg).(variable); !ok {
+			i.errs[p.id] = fmt.Errorf("expected variable but got %s", walkDeep(b, arg).PrintExpression())
+			return nil, nil, false, nil
+		}
+	}
+	pt := i.openPort(p, walk(b, p.args[1]).(variable))
+	return bindings{walk(b, p.args[0]).(variable): pt}, nil, true, nil
+}
+
+// send(Port, Msg)   % add Msg to the stream of Port
+func builtinSend(i *Interpreter, b bindings, p process) (bindings, []process, bool, []variable) {
+	x := walk(b, p.args[0])
+	if v, ok := x.(variable); ok {
+		return nil, nil, false, []variable{v}
+	}
+	pt, ok := x.(port)
+	if !ok {
+		i.errs[p.id] = fmt.Errorf("expected a port but got %s", walkDeep(b, x).PrintExpression())
+		return nil, nil, false, nil
+	}
+	theta, err := i.send(pt, walk(b, p.args[1]))
+	if err != nil {
+		i.errs[p.id] = err
+		return nil, nil, false, nil
+	}
+	return theta, nil, true, nil
+}
+
+// call(Goal, Args...)   % run Goal, with Args added to its arguments
+// Goal is an atom like nl or a compound term like add(1), resolved against
+// the rules and builtins once it is bound, so goals can be passed around
+func builtinCall(i *Interpreter, b bindings, p process) (bindings, []process, bool, []variable) {
+	var goal process
+	switch t := walk(b, p.args[0]).(type) {
+	case variable:
+		return nil, nil, false, []variable{t}
+	case atom:
+		goal.functor = string(t)
+	case compound:
+		goal.functor = t.functor
+		goal.args, _ = listElements(t.args)
+	default:
+		i.errs[p.id] = fmt.Errorf("expected a goal but got %s", walkDeep(b, t).PrintExpression())
+		return nil, nil, false, nil
+	}
+	goal.args = append(goal.args, p.args[1:]...)
+	return bindings{}, []process{goal}, true, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+var callProgram = MustParseRules(`
+    map(F, [X|Xs], Ys) :- call(F, X, Y), Ys := [Y|Ys1], map(F, Xs, Ys1).
+    map(F, [], Ys) :- Ys := [].
+    add(N, X, Y) :- isplus(Y, N, X).
+    apply(add(N), X, Y) :- isplus(Y, N, X).
+    apply(double, X, Y) :- isplus(Y, X, X).`)
+
+func TestCall(t *testing.T) {
+	for name, interpret := range schedulers {
+		for _, e := range engines {
+			for _, tt := range []struct {
+				goal string
+				want string
+			}{
+				{"map(add(10), [1,2,3], R)", "[11|[12|[13]]]"},
+				{"map(apply(add(2)), [1,2], R)", "[3|[4]]"},
+				{"map(apply(double), [1,2], R)", "[2|[4]]"},
+				// waits for the goal to be bound
+				{"call(G, 1, R), G := add(5)", "6"},
+				{"R := add(X, [Y]), X := 1", "add(1,[v#2])"},
+			} {
+				i := NewInterpreter(callProgram, 2)
+				i.engine = e
+				q, b := i.MustParseProcesses(tt.goal)
+				res, deadlocked, _ := interpret(i, q)
+				if deadlocked {
+					t.Fatalf("%s engine %d %s: deadlocked!\n%s", name, e, tt.goal, i.Report())
+				}
+				if got := walkDeep(res, b["R"]).PrintExpression(); got != tt.want {
+					t.Errorf("%s engine %d %s: expected %s but got %s", name, e, tt.goal, tt.want, got)
+				}
+			}
+		}
+	}
+}
+
+func TestCallBuiltin(t *testing.T) {
+	i := NewSingleThreadedInterpreter(nil)
+	var out bytes.Buffer
+	i.SetOutput(&out)
+	q, _ := i.MustParseProcesses("call(writeln, hello), call(42)")
+	if _, deadlocked, _ := i.interpretSinglethreaded(q); deadlocked {
+		t.Fatalf("deadlocked!\n%s", i.Report())
+	}
+	if out.String() != "hello\n" {
+		t.Errorf("expected hello but got %q", out.String())
+	}
+	if got := i.Report(); got != "failed: #2 call(42): expected a goal but got 42\n" {
+		t.Errorf("expected call(42) to fail but got\n%s", got)
+	}
+}
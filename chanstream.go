@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+/*
+Bridges between Go channels and Strand streams, so that Go code can feed a
+long-running network and consume what it produces while it runs.
+
+FeedStream makes a variable of the goal the stream of the values received
+from a channel. Every value extends the stream as soon as it arrives, much
+like the result of an async call (see async.go), and closing the channel
+ends the stream with []. Until then the run is live.
+
+ReadStream goes the other way: it returns a channel that receives every
+element of a stream as soon as the element is fully bound, in order, and is closed
+at the end of the stream or when the run is over. Elements are queued, so a
+slow reader does not hold up the run; a reader that stops early calls the
+stop function it got along with the channel.
+
+Both are set up before running the goal.
+*/
+
+// FeedStream makes v, an unbound variable of the goal, the stream of
+// values received from ch, converted by Marshal
+func FeedStream[T any](i *Interpreter, v Term, ch <-chan T) error {
+	start, ok := v.(variable)
+	if !ok {
+		return fmt.Errorf("strand: cannot feed %s, expected a variable", v.PrintExpression())
+	}
+	i.feeds = append(i.feeds, func() {
+		// not a real process, but bindings need one to be made by
+		p := process{functor: "feed", args: []expression{start}, id: i.procCounter.Add(1)}
+		// the end of the stream so far, only used under the write lock
+		end := start
+		failed := false
+		extend := func(x any, last bool) func(i *Interpreter) (bindings, bool) {
+			return func(i *Interpreter) (bindings, bool) {
+				if failed {
+					return nil, true
+				}
+				var e expression = emptylist
+				if !last {
+					head, err := Marshal(x)
+					if err != nil {
+						failed = true
+						i.errs[p.id] = err
+						return nil, false
+					}
+					e = list{head: head, tail: i.fresh()}
+				}
+				if _, bound := i.bindings[end]; bound {
+					failed = true
+					i.errs[p.id] = fmt.Errorf("stream %s was bound by someone else", end.PrintExpression())
+					return nil, false
+				}
+				theta := bindings{end: e}
+				if l, ok := e.(list); ok {
+					end = l.tail.(variable)
+				}
+				return theta, true
+			}
+		}
+		host := i.async
+		host.started()
+		go func() {
+			for x := range ch {
+				host.finished(asyncResult{p: p, outputs: extend(x, false), more: true})
+			}
+			host.finished(asyncResult{p: p, outputs: extend(nil, true)})
+		}()
+	})
+	return nil
+}
+
+// ReadStream returns a channel receiving the elements of stream v, converted
+// by Unmarshal; an element that does not convert to T closes it early.
+// Calling stop closes it too, for a reader not interested in the rest
+func ReadStream[T any](i *Interpreter, v Term) (ch <-chan T, stop func()) {
+	q := &termQueue{done: make(chan struct{})}
+	q.cond = sync.NewCond(&q.mu)
+	w := &streamWatcher{pos: v, q: q}
+	if next, ok := w.advance(i.bindings); ok {
+		if i.watchers == nil {
+			i.watchers = map[variable][]*streamWatcher{}
+		}
+		i.watchers[next] = append(i.watchers[next], w)
+	}
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			t, ok := q.pop()
+			if !ok {
+				return
+			}
+			var x T
+			if err := Unmarshal(t, &x); err != nil {
+				q.stop()
+				return
+			}
+			select {
+			case out <- x:
+			case <-q.done:
+				return
+			}
+		}
+	}()
+	return out, q.stop
+}
+
+// follows a stream as it gets bound
+type streamWatcher struct {
+	// the rest of the stream
+	pos expression
+	q   *termQueue
+}
+
+// advance queues the elements of the stream bound in b and returns the
+// variable to wait for next, or false at the end of the stream
+func (w *streamWatcher) advance(b bindings) (variable, bool) {
+	for {
+		switch t := walk(b, w.pos).(type) {
+		case variable:
+			return t, true
+		case list:
+			// an element is only passed on once it is fully bound
+			head := walkDeep(b, t.head)
+			if vars := unboundIn(head, nil); len(vars) > 0 {
+				return vars[0], true
+			}
+			w.q.push(head)
+			w.pos = t.tail
+		default:
+			w.q.close()
+			return 0, false
+		}
+	}
+}
+
+// watch is called by bind for every variable it binds
+func (i *Interpreter) watch(b bindings, v variable) {
+	ws, ok := i.watchers[v]
+	if !ok {
+		return
+	}
+	delete(i.watchers, v)
+	for _, w := range ws {
+		if next, ok := w.advance(b); ok {
+			i.watchers[next] = append(i.watchers[next], w)
+		}
+	}
+}
+
+// an unbounded queue of terms, from a watcher to its channel
+type termQueue struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	items []Term
+	// no more items are coming; or nobody reads them anymore
+	closed, stopped bool
+	// closed once stopped
+	done chan struct{}
+}
+
+func (q *termQueue) push(t Term) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stopped {
+		return
+	}
+	q.items = append(q.items, t)
+	q.cond.Signal()
+}
+
+func (q *termQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Signal()
+}
+
+func (q *termQueue) stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stopped {
+		return
+	}
+	q.stopped = true
+	q.items = nil
+	close(q.done)
+	q.cond.Signal()
+}
+
+// pop waits for the next item, and returns false once there are no more
+func (q *termQueue) pop() (Term, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && !q.closed && !q.stopped {
+		q.cond.Wait()
+	}
+	if len(q.items) == 0 {
+		return nil, false
+	}
+	t := q.items[0]
+	q.items = q.items[1:]
+	return t, true
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestChannelStreams(t *testing.T) {
+	s := MustParseRules(`
+    double([X|Xs], Out) :- isplus(Y, X, X), Out := [Y|Out1], double(Xs, Out1).
+    double([], Out) :- Out := [].`)
+	for name, interpret := range schedulers {
+		for _, e := range engines {
+			i := NewInterpreter(s, 2)
+			i.engine = e
+			q, b := i.MustParseProcesses("double(In, Out)")
+			in := make(chan int)
+			if err := FeedStream(i, b["In"], in); err != nil {
+				t.Fatal(err)
+			}
+			out, _ := ReadStream[int](i, b["Out"])
+			done := make(chan bool)
+			go func() {
+				_, deadlocked, _ := interpret(i, q)
+				done <- deadlocked
+			}()
+			// one at a time: every answer has to come out
+			// while the run is still going
+			for n := 1; n <= 5; n++ {
+				in <- n
+				if got := <-out; got != 2*n {
+					t.Fatalf("%s engine %d: expected %d but got %d", name, e, 2*n, got)
+				}
+			}
+			close(in)
+			if got, ok := <-out; ok {
+				t.Errorf("%s engine %d: expected the end of the stream but got %d", name, e, got)
+			}
+			if <-done {
+				t.Errorf("%s engine %d: deadlocked!", name, e)
+			}
+		}
+	}
+}
+
+func TestReadStreamEndOfRun(t *testing.T) {
+	i := NewSingleThreadedInterpreter(nil)
+	q, b := i.MustParseProcesses("S := [1,2|T]")
+	out, _ := ReadStream[any](i, b["S"])
+	i.interpretSinglethreaded(q)
+	var got []any
+	for x := range out {
+		got = append(got, x)
+	}
+	// nothing more can come once the run is over
+	if len(got) != 2 || got[0] != int64(1) || got[1] != int64(2) {
+		t.Errorf("expected [1 2] but got %v", got)
+	}
+}
+
+func TestReadStreamStop(t *testing.T) {
+	s := MustParseRules(`
+    count(N, Out) :- Out := [N|Out1], isplus(N1, N, 1), count(N1, Out1).`)
+	i := NewInterpreter(s, 2)
+	q, b := i.MustParseProcesses("count(1, Out)")
+	out, stop := ReadStream[int](i, b["Out"])
+	done := make(chan struct{})
+	go func() {
+		i.interpretWorkStealing(q)
+		close(done)
+	}()
+	for n := 1; n <= 3; n++ {
+		if got := <-out; got != n {
+			t.Fatalf("expected %d but got %d", n, got)
+		}
+	}
+	// the reader goes away while the stream keeps growing
+	stop()
+	for range out {
+	}
+	i.Interrupt()
+	<-done
+}
+
+func TestReadStreamPartial(t *testing.T) {
+	s := MustParseRules(`
+    pairs(S) :- A := 1, S := [[A|T]|S1], T := [], S1 := [].`)
+	for name, interpret := range schedulers {
+		i := NewInterpreter(s, 2)
+		q, b := i.MustParseProcesses("pairs(S)")
+		out, _ := ReadStream[[]any](i, b["S"])
+		go interpret(i, q)
+		// only the element as a whole comes out, not [1|T] first
+		got, ok := <-out
+		if !ok || len(got) != 1 || got[0] != int64(1) {
+			t.Errorf("%s: expected [1] but got %v", name, got)
+		}
+		for range out {
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+ChromeTracer collects events and writes them in the Chrome Trace Event format,
+which can be opened in chrome://tracing or ui.perfetto.dev.
+There is one track per worker, track 0 being the main interpreter routine.
+Every reduction attempt and builtin execution is a span on the track of the
+worker that did it, labelled with functor/arity, however short it was.
+Suspensions are instant events, and so are wakeups, on the track of the
+worker whose binding woke the process.
+*/
+
+type ChromeTracer struct {
+	sync.Mutex
+	events  []chromeEvent
+	workers map[int]struct{}
+}
+
+type chromeEvent struct {
+	Name  string            `json:"name"`
+	Phase string            `json:"ph"`
+	Time  float64           `json:"ts"`
+	Dur   float64           `json:"dur,omitempty"`
+	Pid   int               `json:"pid"`
+	Tid   int               `json:"tid"`
+	Scope string            `json:"s,omitempty"`
+	Args  map[string]string `json:"args,omitempty"`
+	// Time is filled in relative to the earliest event on Write
+	at time.Time
+}
+
+func NewChromeTracer() *ChromeTracer {
+	return &ChromeTracer{workers: map[int]struct{}{}}
+}
+
+func (c *ChromeTracer) Trace(e Event) {
+	c.Lock()
+	defer c.Unlock()
+	c.workers[e.Worker] = struct{}{}
+	name := fmt.Sprintf("%s/%d", e.Process.functor, e.Process.arity())
+	switch e.Kind {
+	case EventReduce, EventSuspend, EventFail:
+		args := map[string]string{"process": e.Process.String(), "outcome": e.Kind.String()}
+		if e.Kind == EventReduce {
+			args["rule"] = e.Rule.String()
+		}
+		c.events = append(c.events, chromeEvent{
+			Name:  name,
+			Phase: "X",
+			at:    e.Time,
+			// zero would be dropped, but the span did happen
+			Dur:  max(float64(e.Duration.Nanoseconds())/1000, 0.001),
+			Tid:  e.Worker,
+			Args: args,
+		})
+		if e.Kind == EventSuspend {
+			c.events = append(c.events, chromeEvent{
+				Name:  "suspend " + name,
+				Phase: "i",
+				at:    e.Time.Add(e.Duration),
+				Tid:   e.Worker,
+				Scope: "t",
+				Args:  map[string]string{"process": e.Process.String(), "vars": printVars(e.Vars)},
+			})
+		}
+	case EventWakeup:
+		c.events = append(c.events, chromeEvent{
+			Name:  "wakeup " + name,
+			Phase: "i",
+			at:    e.Time,
+			Tid:   e.Worker,
+			Scope: "t",
+			Args:  map[string]string{"process": e.Process.String(), "var": e.Var.PrintExpression()},
+		})
+	}
+}
+
+// Write writes everything collected so far as a single JSON document
+func (c *ChromeTracer) Write(w io.Writer) error {
+	c.Lock()
+	defer c.Unlock()
+	workers := []int{}
+	for n := range c.workers {
+		workers = append(workers, n)
+	}
+	sort.Ints(workers)
+	events := []chromeEvent{}
+	for _, n := range workers {
+		name := fmt.Sprintf("worker %d", n)
+		if n == 0 {
+			name = "main"
+		}
+		events = append(events, chromeEvent{Name: "thread_name", Phase: "M", Tid: n, Args: map[string]string{"name": name}})
+	}
+	var start time.Time
+	for _, e := range c.events {
+		if start.IsZero() || e.at.Before(start) {
+			start = e.at
+		}
+	}
+	for _, e := range c.events {
+		// in microseconds
+		e.Time = float64(e.at.Sub(start).Nanoseconds()) / 1000
+		events = append(events, e)
+	}
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents []chromeEvent `json:"traceEvents"`
+	}{events})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestChromeTracer(t *testing.T) {
+	i := NewInterpreter(templateProgram, 4)
+	c := NewChromeTracer()
+	i.SetTracer(c)
+	q, _ := i.MustParseProcesses("sum([1,2,3,4,5],R)")
+	i.interpret(q)
+	var buf bytes.Buffer
+	if err := c.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		TraceEvents []chromeEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	spans := map[string]int{}
+	for _, e := range doc.TraceEvents {
+		if e.Phase != "X" {
+			continue
+		}
+		// the pool runs builtins on the main routine
+		builtin := e.Name == "isplus/3" || e.Name == ":=/2"
+		if builtin && e.Tid != 0 || !builtin && (e.Tid < 1 || e.Tid > 4) {
+			t.Errorf("expected %s on a worker track but got %d", e.Name, e.Tid)
+		}
+		spans[e.Name]++
+	}
+	if spans["sum/2"] != 1 || spans["sum1/3"] != 6 {
+		t.Errorf("expected a span for sum/2 and six for sum1/3 but got %v", spans)
+	}
+	// builtins are spans too, however quick
+	if spans["isplus/3"] < 5 || spans[":=/2"] < 1 {
+		t.Errorf("expected spans for the builtins but got %v", spans)
+	}
+}
+
+func TestChromeTracerWakeups(t *testing.T) {
+	i := NewInterpreter(templateProgram, 4)
+	c := NewChromeTracer()
+	i.SetTracer(c)
+	q, _ := i.MustParseProcesses("sum([1|L],R), L := [2,3]")
+	i.interpretWorkStealing(q)
+	var buf bytes.Buffer
+	if err := c.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		TraceEvents []chromeEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	wakeups := 0
+	for _, e := range doc.TraceEvents {
+		if strings.HasPrefix(e.Name, "wakeup ") {
+			wakeups++
+		}
+		if e.Phase == "M" || e.Tid >= 1 && e.Tid <= 4 {
+			continue
+		}
+		// every worker binds on its own track
+		t.Errorf("expected %s on a worker track but got %d", e.Name, e.Tid)
+	}
+	if wakeups == 0 {
+		t.Errorf("expected sum1 to be woken up once L is bound")
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime/pprof"
+	"sort"
+	"strings"
+)
+
+// parseArgs allows the program file to come before the flags,
+// as in strandbeest run prog.strand -goal "..."
+// It returns the file and the arguments left after it
+func parseArgs(fs *flag.FlagSet, args []string) (string, []string, error) {
+	var file string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		file, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return "", nil, err
+	}
+	rest := fs.Args()
+	if file == "" && len(rest) > 0 {
+		file, rest = rest[0], rest[1:]
+	}
+	if file == "" {
+		return "", nil, fmt.Errorf("%s: missing program file", fs.Name())
+	}
+	return file, rest, nil
+}
+
+func readProgram(file string) ([]rule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(string(data))
+}
+
+// formatResults prints the value of each named query variable, sorted by name
+func formatResults(names map[string]variable, b bindings) string {
+	keys := []string{}
+	for k := range names {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "%s = %s\n", k, walkDeep(b, names[k]).PrintExpression())
+	}
+	return sb.String()
+}
+
+// walkDeep is walk, but also resolves variables nested in lists
+func walkDeep(b bindings, e expression) expression {
+	e = walk(b, e)
+	if l, ok := e.(list); ok {
+		return list{head: walkDeep(b, l.head), tail: walkDeep(b, l.tail)}
+	}
+	if c, ok := e.(compound); ok {
+		return compound{functor: c.functor, args: walkDeep(b, c.args)}
+	}
+	return e
+}
+
+func runCmd(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	goal := fs.String("goal", "", "initial processes")
+	workers := fs.Int("workers", 0, "number of workers; 0 runs single-threaded")
+	vm := fs.Bool("vm", false, "reduce using compiled code")
+	goroutines := fs.Bool("goroutines", false, "run each process in its own goroutine")
+	pool := fs.Bool("pool", false, "run on the pool-based scheduler instead of work-stealing; needs -workers")
+	trace := fs.Bool("trace", false, "write execution events to stderr")
+	traceFormat := fs.String("trace-format", "text", "trace output format: text or json")
+	chromeTrace := fs.String("chrome-trace", "", "write a Chrome trace of the run to this file")
+	profile := fs.Bool("profile", false, "print per rule statistics to stderr")
+	stats := fs.Bool("stats", false, "print run statistics to stderr")
+	cpuprofile := fs.String("cpuprofile", "", "write a CPU profile labelled by predicate to this file")
+	record := fs.String("record", "", "record the choices made during the run to this file")
+	replay := fs.String("replay", "", "replay the choices recorded in this file, single-threaded")
+	dot := fs.String("dot", "", "write the dataflow graph of the run to this file in DOT format")
+	file, _, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *pool && *workers < 1 {
+		return fmt.Errorf("run: -pool needs -workers")
+	}
+	program, err := readProgram(file)
+	if err != nil {
+		return err
+	}
+	i := NewSingleThreadedInterpreter(program)
+	if *workers > 0 {
+		i = NewInterpreter(program, *workers)
+	}
+	if *vm {
+		i.engine = vmEngine
+	}
+	if *record != "" {
+		f, err := os.Create(*record)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		i.Record(f)
+	}
+	var choices []choice
+	if *replay != "" {
+		f, err := os.Open(*replay)
+		if err != nil {
+			return err
+		}
+		choices, err = readChoices(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if *profile {
+		i.EnableProfiling()
+	}
+	if *cpuprofile != "" {
+		f, err := os.Create(*cpuprofile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return err
+		}
+		defer pprof.StopCPUProfile()
+		i.EnablePprofLabels(context.Background())
+	}
+	var tracers []Tracer
+	if *trace {
+		switch *traceFormat {
+		case "text":
+			tracers = append(tracers, NewTextTracer(os.Stderr))
+		case "json":
+			tracers = append(tracers, NewJSONTracer(os.Stderr))
+		default:
+			return fmt.Errorf("unknown trace format %q", *traceFormat)
+		}
+	}
+	var chrome *ChromeTracer
+	if *chromeTrace != "" {
+		chrome = NewChromeTracer()
+		tracers = append(tracers, chrome)
+	}
+	var dataflow *DataflowTracer
+	if *dot != "" {
+		dataflow = NewDataflowTracer()
+		tracers = append(tracers, dataflow)
+	}
+	if len(tracers) > 0 {
+		i.SetTracer(MultiTracer(tracers...))
+	}
+	q, names, err := i.ParseProcesses(*goal)
+	if err != nil {
+		return err
+	}
+	// a run that never ends is exactly the one whose network we want to see,
+	// so the first interrupt stops the run and whatever it wrote is finished
+	interrupt, done := make(chan os.Signal, 1), make(chan struct{})
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	defer close(done)
+	go func() {
+		select {
+		case <-interrupt:
+			// a second interrupt kills us as usual
+			signal.Stop(interrupt)
+			i.Interrupt()
+		case <-done:
+		}
+	}()
+	var res bindings
+	var deadlocked bool
+	var st Stats
+	switch {
+	case *replay != "":
+		res, deadlocked, st, err = i.interpretReplay(q, choices)
+		if err != nil {
+			return err
+		}
+	case *goroutines:
+		res, deadlocked, st = i.interpretGoroutines(q)
+	case *pool:
+		// the pool cannot detect a deadlock, it keeps waiting instead
+		res, st = i.interpret(q)
+	case *workers > 0:
+		res, deadlocked, st = i.interpretWorkStealing(q)
+	default:
+		res, deadlocked, st = i.interpretSinglethreaded(q)
+	}
+	if *stats {
+		fmt.Fprint(os.Stderr, st)
+	}
+	if *profile {
+		if err := i.WriteProfile(os.Stderr); err != nil {
+			return err
+		}
+	}
+	if chrome != nil {
+		if err := writeChromeTrace(chrome, *chromeTrace); err != nil {
+			return err
+		}
+	}
+	if dataflow != nil {
+		if err := writeDataflow(dataflow, names, *dot); err != nil {
+			return err
+		}
+	}
+	if i.interrupted() {
+		return fmt.Errorf("interrupted")
+	}
+	report := i.Report()
+	if deadlocked {
+		return fmt.Errorf("deadlock\n%s", strings.TrimSuffix(report, "\n"))
+	}
+	if report != "" {
+		fmt.Fprint(os.Stderr, report)
+	}
+	fmt.Print(formatResults(names, res))
+	return nil
+}
+
+func writeChromeTrace(c *ChromeTracer, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := c.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeDataflow(g *DataflowTracer, names map[string]variable, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := g.Write(f, names); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func buildCmd(args []string) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	goal := fs.String("goal", "", "initial processes")
+	out := fs.String("o", "", "output file; defaults to stdout")
+	file, _, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	program, err := readProgram(file)
+	if err != nil {
+		return err
+	}
+	q, names, err := NewSingleThreadedInterpreter(program).ParseProcesses(*goal)
+	if err != nil {
+		return err
+	}
+	src, err := transpile(program, q, names)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(*out, src, 0o644)
+}
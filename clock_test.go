@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+var timerProgram = MustParseRules(`
+    go(R) :- timer(100, D), later(D, R).
+    later(true, R) :- now(R).`)
+
+func TestTimer(t *testing.T) {
+	start := time.UnixMilli(1000000)
+	for name, interpret := range schedulers {
+		for _, e := range engines {
+			clock := NewFakeClock(start)
+			i := NewInterpreter(timerProgram, 2)
+			i.engine = e
+			i.SetClock(clock)
+			q, b := i.MustParseProcesses("go(R)")
+			type result struct {
+				res        bindings
+				deadlocked bool
+			}
+			done := make(chan result)
+			go func() {
+				res, deadlocked, _ := interpret(i, q)
+				done <- result{res, deadlocked}
+			}()
+			for clock.Waiting() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			// nothing left to do but wait: the run has to stay alive
+			clock.Advance(50 * time.Millisecond)
+			select {
+			case <-done:
+				t.Fatalf("%s engine %d: finished before the timer went off", name, e)
+			case <-time.After(20 * time.Millisecond):
+			}
+			clock.Advance(50 * time.Millisecond)
+			r := <-done
+			if r.deadlocked {
+				t.Fatalf("%s engine %d: deadlocked!\n%s", name, e, i.Report())
+			}
+			if got := walk(r.res, b["R"]); got != number(1000100) {
+				t.Errorf("%s engine %d: expected 1000100 but got %s", name, e, got.PrintExpression())
+			}
+		}
+	}
+}
+
+func TestRealTimer(t *testing.T) {
+	i := NewSingleThreadedInterpreter(timerProgram)
+	q, b := i.MustParseProcesses("go(R)")
+	start := time.Now()
+	res, deadlocked, _ := i.interpretSinglethreaded(q)
+	if deadlocked {
+		t.Fatalf("deadlocked!\n%s", i.Report())
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("expected the run to take at least 100ms but it took %s", d)
+	}
+	if _, ok := walk(res, b["R"]).(number); !ok {
+		t.Errorf("expected the time but got %s", walk(res, b["R"]).PrintExpression())
+	}
+}
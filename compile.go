@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+Compiler from rules to a small Strand abstract machine.
+Each functor/arity becomes one procedure: a switch on the type of the first
+argument followed by the code for each clause. Clause code works on registers;
+registers 0..arity-1 start out holding the arguments of the process.
+
+	head:  get_value, get_const, get_list, get_struct (match an argument register)
+	guard: put_const, guard                           (load constants, test)
+	       commit
+	body:  put_var, put_const, put_list, put_struct,  (build arguments, spawn process)
+	       spawn
+	       proceed
+
+Head variables are never copied: they simply name the register holding
+whatever the process passed in, so unlike freshCopy no new variables are
+allocated except for variables that only occur in the body.
+*/
+
+type opcode uint8
+
+const (
+	opSwitchOnType opcode = iota
+	opGetValue
+	opGetConst
+	opGetList
+	opGetStruct
+	opPutConst
+	opPutVar
+	opPutList
+	opPutStruct
+	opGuard
+	opCommit
+	opSpawn
+	opProceed
+)
+
+var opnames = map[opcode]string{
+	opSwitchOnType: "switch_on_type",
+	opGetValue:     "get_value",
+	opGetConst:     "get_const",
+	opGetList:      "get_list",
+	opGetStruct:    "get_struct",
+	opPutConst:     "put_const",
+	opPutVar:       "put_var",
+	opPutList:      "put_list",
+	opPutStruct:    "put_struct",
+	opGuard:        "guard",
+	opCommit:       "commit",
+	opSpawn:        "spawn",
+	opProceed:      "proceed",
+}
+
+// not every field is used by every opcode:
+// get_value    a: argument register, b: variable register
+// get_const    a: register, k: constant
+// get_list     a: register, b: head register, c: tail register
+// put_const    a: register, k: constant
+// put_var      a: register
+// put_list     a: register, b: head register, c: tail register
+// get_struct   a: register, s: functor, b: args register
+// put_struct   a: register, s: functor, b: args register
+// guard        s: operator, a, b: registers
+// spawn        s: functor, regs: argument registers
+func (op opcode) isGet() bool {
+	return op == opGetValue || op == opGetConst || op == opGetList || op == opGetStruct
+}
+
+type instr struct {
+	op      opcode
+	a, b, c int
+	k       expression
+	s       string
+	regs    []int
+	table   *switchTable
+}
+
+func (in instr) String() string {
+	name := opnames[in.op]
+	switch in.op {
+	case opSwitchOnType:
+		return fmt.Sprintf("%s %d", name, len(in.table.all))
+	case opGetValue:
+		return fmt.Sprintf("%s r%d, r%d", name, in.a, in.b)
+	case opGetConst, opPutConst:
+		return fmt.Sprintf("%s r%d, %s", name, in.a, in.k.PrintExpression())
+	case opGetList, opPutList:
+		return fmt.Sprintf("%s r%d, r%d, r%d", name, in.a, in.b, in.c)
+	case opGetStruct, opPutStruct:
+		return fmt.Sprintf("%s r%d, %s, r%d", name, in.a, in.s, in.b)
+	case opPutVar:
+		return fmt.Sprintf("%s r%d", name, in.a)
+	case opGuard:
+		return fmt.Sprintf("%s r%d %s r%d", name, in.a, in.s, in.b)
+	case opSpawn:
+		regs := []string{}
+		for _, r := range in.regs {
+			regs = append(regs, fmt.Sprintf("r%d", r))
+		}
+		return fmt.Sprintf("%s %s/%d, %s", name, in.s, len(in.regs), strings.Join(regs, ", "))
+	}
+	return name
+}
+
+// switchTable maps the principal type of the first argument to clause numbers,
+// using the same keys as the clause index
+type switchTable struct {
+	all         []int
+	byFirstArg  map[expression][]int
+	varFirstArg []int
+}
+
+type compiledClause struct {
+	rule  rule
+	entry int
+	nregs int
+	// register holding each variable of the rule
+	vars map[variable]int
+}
+
+type compiledProc struct {
+	code    []instr
+	clauses []compiledClause
+}
+
+type compiledProgram map[procKey]*compiledProc
+
+func compileProgram(program []rule) compiledProgram {
+	out := compiledProgram{}
+	for k, proc := range indexProgram(program) {
+		out[k] = compileProcedure(proc)
+	}
+	return out
+}
+
+func compileProcedure(proc *procedure) *compiledProc {
+	c := &compiledProc{}
+	table := &switchTable{byFirstArg: map[expression][]int{}}
+	// same grouping as indexProgram, but by clause number
+	for n, r := range proc.all {
+		table.all = append(table.all, n)
+		if r.head.arity() == 0 {
+			continue
+		}
+		key, ok := firstArgKey(r.head.args[0])
+		if ok {
+			if _, seen := table.byFirstArg[key]; !seen {
+				table.byFirstArg[key] = append([]int{}, table.varFirstArg...)
+			}
+			table.byFirstArg[key] = append(table.byFirstArg[key], n)
+			continue
+		}
+		table.varFirstArg = append(table.varFirstArg, n)
+		for key := range table.byFirstArg {
+			table.byFirstArg[key] = append(table.byFirstArg[key], n)
+		}
+	}
+	c.code = append(c.code, instr{op: opSwitchOnType, table: table})
+	for _, r := range proc.all {
+		cc := &clauseCompiler{regs: map[variable]int{}, next: r.head.arity()}
+		entry := len(c.code)
+		cc.compile(r)
+		c.code = append(c.code, cc.code...)
+		c.clauses = append(c.clauses, compiledClause{rule: r, entry: entry, nregs: cc.next, vars: cc.regs})
+	}
+	return c
+}
+
+type clauseCompiler struct {
+	code []instr
+	// register holding each rule variable
+	regs map[variable]int
+	next int
+}
+
+func (cc *clauseCompiler) alloc() int {
+	r := cc.next
+	cc.next++
+	return r
+}
+
+func (cc *clauseCompiler) emit(in instr) {
+	cc.code = append(cc.code, in)
+}
+
+func (cc *clauseCompiler) compile(r rule) {
+	for n, arg := range r.head.args {
+		cc.compileHead(n, arg)
+	}
+	for _, g := range r.guard {
+		a := cc.compileBody(g.args[0])
+		b := cc.compileBody(g.args[1])
+		cc.emit(instr{op: opGuard, s: g.operator, a: a, b: b})
+	}
+	cc.emit(instr{op: opCommit})
+	for _, p := range r.body {
+		regs := make([]int, len(p.args))
+		for n, arg := range p.args {
+			regs[n] = cc.compileBody(arg)
+		}
+		cc.emit(instr{op: opSpawn, s: p.functor, regs: regs})
+	}
+	cc.emit(instr{op: opProceed})
+}
+
+// match the term in register reg against head argument e
+func (cc *clauseCompiler) compileHead(reg int, e expression) {
+	switch t := e.(type) {
+	case variable:
+		if vreg, ok := cc.regs[t]; ok {
+			cc.emit(instr{op: opGetValue, a: reg, b: vreg})
+			return
+		}
+		cc.regs[t] = reg
+	case list:
+		h, tl := cc.alloc(), cc.alloc()
+		cc.emit(instr{op: opGetList, a: reg, b: h, c: tl})
+		cc.compileHead(h, t.head)
+		cc.compileHead(tl, t.tail)
+	case compound:
+		args := cc.alloc()
+		cc.emit(instr{op: opGetStruct, a: reg, s: t.functor, b: args})
+		cc.compileHead(args, t.args)
+	default:
+		if e == underscore {
+			return
+		}
+		cc.emit(instr{op: opGetConst, a: reg, k: e})
+	}
+}
+
+// returns the register that will hold e
+func (cc *clauseCompiler) compileBody(e expression) int {
+	switch t := e.(type) {
+	case variable:
+		if vreg, ok := cc.regs[t]; ok {
+			return vreg
+		}
+		r := cc.alloc()
+		cc.regs[t] = r
+		cc.emit(instr{op: opPutVar, a: r})
+		return r
+	case list:
+		h := cc.compileBody(t.head)
+		tl := cc.compileBody(t.tail)
+		r := cc.alloc()
+		cc.emit(instr{op: opPutList, a: r, b: h, c: tl})
+		return r
+	case compound:
+		args := cc.compileBody(t.args)
+		r := cc.alloc()
+		cc.emit(instr{op: opPutStruct, a: r, s: t.functor, b: args})
+		return r
+	}
+	r := cc.alloc()
+	cc.emit(instr{op: opPutConst, a: r, k: e})
+	return r
+}
+
+func (c *compiledProc) String() string {
+	lines := []string{}
+	for n, in := range c.code {
+		lines = append(lines, fmt.Sprintf("%4d  %s", n, in))
+	}
+	return strings.Join(lines, "\n")
+}
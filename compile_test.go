@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestCompileProcedure(t *testing.T) {
+	s := MustParseRules(`
+    sum1([X|Xs], A, Sum) :-
+        isplus(A1, A, X),
+        sum1(Xs, A1, Sum).
+    sum1([], A, Sum) :-
+        Sum := A.`)
+	proc := compileProgram(s)[procKey{"sum1", 3}]
+	want := `   0  switch_on_type 2
+   1  get_list r0, r3, r4
+   2  commit
+   3  put_var r5
+   4  spawn isplus/3, r5, r1, r3
+   5  spawn sum1/3, r4, r5, r2
+   6  proceed
+   7  get_const r0, []
+   8  commit
+   9  spawn :=/2, r2, r1
+  10  proceed`
+	if got := proc.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEnginesAgree(t *testing.T) {
+	s := MustParseRules(`
+    pair([X|Xs], [Y|Ys], R) :- R := [X,Y].
+    pair(A, B, R) :- A == B | R := same.
+    one([X], [Y], R) :- R := X.`)
+	for _, goal := range []string{
+		// both lists unbound: suspends on both, from either clause
+		"pair(P, Q, R)",
+		"pair([1|T], [2|U], R)",
+		"one(P, Q, R)",
+	} {
+		var results [2]string
+		for _, e := range engines {
+			i := NewSingleThreadedInterpreter(s)
+			i.engine = e
+			q, b := i.MustParseProcesses(goal)
+			ok, theta, r, sus, _ := i.reduceProcess(0, i.bindings, q[0])
+			var names []string
+			for _, v := range sus {
+				for name, w := range b {
+					if v == w {
+						names = append(names, name)
+					}
+				}
+			}
+			sort.Strings(names)
+			res := fmt.Sprintf("%v %v", ok, names)
+			if ok {
+				// the tree-walking engine binds head variables, the vm does not
+				for _, p := range append([]process{r.head}, r.body...) {
+					for n, arg := range p.args {
+						p.args[n] = walkDeep(theta, arg)
+					}
+					res += " " + p.String()
+				}
+			}
+			results[e] = res
+		}
+		if results[astEngine] != results[vmEngine] {
+			t.Errorf("%s: engines disagree:\nast %s\nvm  %s", goal, results[astEngine], results[vmEngine])
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+DataflowTracer builds the process network a run actually created and writes
+it in DOT format. Nodes are processes; a process spawned by a recursive call
+to the same procedure is the same node as its caller, and builtins belong to
+the process that spawned them, so a long-lived loop shows up as one node.
+Edges are the variables shared between nodes, from the node that bound the
+variable to every other node that was given it while it was still unbound.
+When a variable is bound to a list, the variable in its tail is the same
+channel, bound yet or not: the whole stream is a single edge, drawn bold.
+Variables nobody bound are dashed and undirected.
+*/
+
+type DataflowTracer struct {
+	sync.Mutex
+	// node per process id
+	nodes  map[uint64]uint64
+	keys   map[uint64]procKey
+	labels map[uint64]string
+	// what the tracer has seen bound so far
+	values bindings
+	// channels collapsed into another, by aliasing or as a stream tail
+	merged   map[variable]variable
+	holders  map[variable]map[uint64]bool
+	producer map[variable]uint64
+	stream   map[variable]bool
+}
+
+func NewDataflowTracer() *DataflowTracer {
+	return &DataflowTracer{
+		nodes:    map[uint64]uint64{},
+		keys:     map[uint64]procKey{},
+		labels:   map[uint64]string{},
+		values:   bindings{},
+		merged:   map[variable]variable{},
+		holders:  map[variable]map[uint64]bool{},
+		producer: map[variable]uint64{},
+		stream:   map[variable]bool{},
+	}
+}
+
+func (g *DataflowTracer) Trace(e Event) {
+	g.Lock()
+	defer g.Unlock()
+	switch e.Kind {
+	case EventSpawn:
+		g.spawn(e.Process, e.Parent)
+	case EventBind:
+		g.bind(e.Process, e.Var, e.Value)
+	}
+}
+
+func (g *DataflowTracer) spawn(p process, parent uint64) {
+	key := procKey{p.functor, p.arity()}
+	g.keys[p.id] = key
+	node, ok := g.nodes[parent]
+	if !ok || (!p.isPredefined() && g.keys[parent] != key) {
+		node = p.id
+		g.labels[node] = fmt.Sprintf("%s/%d #%d", p.functor, p.arity(), p.id)
+	}
+	g.nodes[p.id] = node
+	for _, arg := range p.args {
+		for _, v := range g.unbound(arg, nil) {
+			c := g.channel(v)
+			if g.holders[c] == nil {
+				g.holders[c] = map[uint64]bool{}
+			}
+			g.holders[c][node] = true
+		}
+	}
+}
+
+func (g *DataflowTracer) bind(by process, v variable, value expression) {
+	c := g.channel(v)
+	g.values[v] = value
+	x := walk(g.values, value)
+	if w, ok := x.(variable); ok {
+		g.merge(c, g.channel(w))
+		return
+	}
+	if len(g.holders[c]) == 0 {
+		// not shared: a rule variable bound when matching the head
+		return
+	}
+	if node, ok := g.nodes[by.id]; ok {
+		if _, seen := g.producer[c]; !seen {
+			g.producer[c] = node
+		}
+	}
+	// the tail of a list carries on the same stream,
+	// whether it has been bound already or not
+	x = value
+	for {
+		switch t := x.(type) {
+		case list:
+			x = t.tail
+			continue
+		case variable:
+			g.stream[c] = true
+			g.merge(c, g.channel(t))
+			if next, ok := g.values[t]; ok {
+				x = next
+				continue
+			}
+		}
+		return
+	}
+}
+
+// unbound appends the unbound variables in e to vars
+func (g *DataflowTracer) unbound(e expression, vars []variable) []variable {
+	switch t := walk(g.values, e).(type) {
+	case variable:
+		return append(vars, t)
+	case list:
+		return g.unbound(t.tail, g.unbound(t.head, vars))
+	case compound:
+		return g.unbound(t.args, vars)
+	}
+	return vars
+}
+
+func (g *DataflowTracer) channel(v variable) variable {
+	if w, ok := walk(g.values, v).(variable); ok {
+		v = w
+	}
+	for {
+		c, ok := g.merged[v]
+		if !ok {
+			return v
+		}
+		v = c
+	}
+}
+
+// merge b into a
+func (g *DataflowTracer) merge(a, b variable) {
+	if a == b {
+		return
+	}
+	g.merged[b] = a
+	if len(g.holders[b]) > 0 && g.holders[a] == nil {
+		g.holders[a] = map[uint64]bool{}
+	}
+	for n := range g.holders[b] {
+		g.holders[a][n] = true
+	}
+	delete(g.holders, b)
+	if p, ok := g.producer[b]; ok {
+		if _, seen := g.producer[a]; !seen {
+			g.producer[a] = p
+		}
+		delete(g.producer, b)
+	}
+	if g.stream[b] {
+		g.stream[a] = true
+		delete(g.stream, b)
+	}
+}
+
+type dataflowEdge struct {
+	from, to uint64
+	channel  variable
+}
+
+// Write writes the graph collected so far in DOT format; edges for the
+// query variables in names are labelled with their name
+func (g *DataflowTracer) Write(w io.Writer, names map[string]variable) error {
+	g.Lock()
+	defer g.Unlock()
+	labels := map[variable]string{}
+	for name, v := range names {
+		labels[g.channel(v)] = name
+	}
+	var edges []dataflowEdge
+	for c, holders := range g.holders {
+		producer, bound := g.producer[c]
+		nodes := []uint64{}
+		for n := range holders {
+			nodes = append(nodes, n)
+		}
+		sort.Slice(nodes, func(a, b int) bool { return nodes[a] < nodes[b] })
+		if !bound && len(nodes) > 1 {
+			// nobody produced this: connect everyone that shares it to the first
+			producer, nodes = nodes[0], nodes[1:]
+		}
+		for _, n := range nodes {
+			if n != producer {
+				edges = append(edges, dataflowEdge{producer, n, c})
+			}
+		}
+	}
+	sort.Slice(edges, func(a, b int) bool {
+		if edges[a].from != edges[b].from {
+			return edges[a].from < edges[b].from
+		}
+		if edges[a].to != edges[b].to {
+			return edges[a].to < edges[b].to
+		}
+		return edges[a].channel < edges[b].channel
+	})
+	nodes := []uint64{}
+	for n := range g.labels {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(a, b int) bool { return nodes[a] < nodes[b] })
+
+	var sb strings.Builder
+	sb.WriteString("digraph dataflow {\n\tnode [shape=box];\n")
+	for _, n := range nodes {
+		fmt.Fprintf(&sb, "\tp%d [label=%q];\n", n, g.labels[n])
+	}
+	for _, e := range edges {
+		label, ok := labels[e.channel]
+		if !ok {
+			label = e.channel.PrintExpression()
+		}
+		var styles, attrs []string
+		if g.stream[e.channel] {
+			label += " (stream)"
+			styles = append(styles, "bold")
+		}
+		if _, bound := g.producer[e.channel]; !bound {
+			styles = append(styles, "dashed")
+			attrs = append(attrs, "dir=none")
+		}
+		if len(styles) > 0 {
+			attrs = append([]string{fmt.Sprintf("style=%q", strings.Join(styles, ","))}, attrs...)
+		}
+		attrs = append([]string{fmt.Sprintf("label=%q", label)}, attrs...)
+		fmt.Fprintf(&sb, "\tp%d -> p%d [%s];\n", e.from, e.to, strings.Join(attrs, ", "))
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDataflowGraph(t *testing.T) {
+	s := MustParseRules(`
+    go(Sum) :- copy([1,2,3], Xs), sum(Xs, Sum).
+    copy([], Ys) :- Ys := [].
+    copy([X|Xs], Ys) :- Ys := [X|Ys1], copy(Xs, Ys1).
+    sum(Xs, S) :- sum1(Xs, 0, S).
+    sum1([], Acc, S) :- S := Acc.
+    sum1([X|Xs], Acc, S) :- isplus(Acc1, Acc, X), sum1(Xs, Acc1, S).`)
+	for _, e := range engines {
+		i := NewSingleThreadedInterpreter(s)
+		i.engine = e
+		g := NewDataflowTracer()
+		i.SetTracer(g)
+		q, names := i.MustParseProcesses("go(S)")
+		if _, deadlocked, _ := i.interpretSinglethreaded(q); deadlocked {
+			t.Fatalf("engine %d: deadlocked!", e)
+		}
+		var buf bytes.Buffer
+		if err := g.Write(&buf, names); err != nil {
+			t.Fatal(err)
+		}
+		// variable numbers differ between engines
+		got := regexp.MustCompile(`v#\d+`).ReplaceAllString(buf.String(), "v")
+		want := `digraph dataflow {
+	node [shape=box];
+	p1 [label="go/1 #1"];
+	p2 [label="copy/2 #2"];
+	p3 [label="sum/2 #3"];
+	p4 [label="sum1/3 #4"];
+	p2 -> p3 [label="v (stream)", style="bold"];
+	p2 -> p4 [label="v (stream)", style="bold"];
+	p4 -> p1 [label="S"];
+	p4 -> p3 [label="S"];
+}
+`
+		if got != want {
+			t.Errorf("engine %d: expected\n%s\nbut got\n%s", e, want, got)
+		}
+	}
+}
+
+func TestDataflowGraphUnbound(t *testing.T) {
+	i := NewSingleThreadedInterpreter(templateProgram)
+	g := NewDataflowTracer()
+	i.SetTracer(g)
+	q, names := i.MustParseProcesses("sum([1,2|T],R)")
+	if _, deadlocked, _ := i.interpretSinglethreaded(q); !deadlocked {
+		t.Fatalf("expected deadlock")
+	}
+	var buf bytes.Buffer
+	if err := g.Write(&buf, names); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`p1 -> p2 [label="T", style="dashed", dir=none];`,
+		`p1 -> p2 [label="R", style="dashed", dir=none];`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected %s in\n%s", want, buf.String())
+		}
+	}
+}
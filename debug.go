@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+Interactive step debugger on top of the single-threaded interpreter.
+Before each step it shows the process that will be taken from the pool and
+the candidate rules, after the step which rule committed or what each
+candidate suspended on. Breakpoints can be set on functor/arity, and on a
+query variable becoming bound.
+*/
+
+const debugHelp = `commands:
+  s, step [n]        take n steps (default 1)
+  c, continue        run until a breakpoint is hit or the pool is empty
+  b, break f/n       break before reducing a process with functor f and arity n
+  w, watch X         break once query variable X is bound
+  d, delete f/n|X    remove a breakpoint or watch
+  pool               show the processes in the pool, next one first
+  susp               show suspended processes per variable
+  p, print X         show the value of query variable X
+  q, quit            stop debugging
+`
+
+type debugger struct {
+	i       *Interpreter
+	names   map[string]variable
+	out     io.Writer
+	breaks  map[procKey]bool
+	watches map[string]bool
+	// outcome per candidate rule of the current step, by clause
+	outcomes map[int]string
+	steps    int
+	// set when a watched variable got bound during the last step
+	watchHit bool
+	// results of async calls, applied between steps
+	async *loopAsync
+}
+
+func newDebugger(i *Interpreter, names map[string]variable, out io.Writer) *debugger {
+	d := &debugger{
+		i:        i,
+		names:    names,
+		out:      out,
+		breaks:   map[procKey]bool{},
+		watches:  map[string]bool{},
+		outcomes: map[int]string{},
+	}
+	i.clauseHook = func(r rule, ok bool, suspendOn []variable) {
+		switch {
+		case ok:
+			d.outcomes[r.clause] = "committed"
+		case len(suspendOn) > 0:
+			d.outcomes[r.clause] = "suspended on " + printVars(suspendOn)
+		default:
+			d.outcomes[r.clause] = "failed"
+		}
+	}
+	return d
+}
+
+func debugCmd(args []string) error {
+	fs := flag.NewFlagSet("debug", flag.ContinueOnError)
+	goal := fs.String("goal", "", "initial processes")
+	file, _, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	program, err := readProgram(file)
+	if err != nil {
+		return err
+	}
+	i := NewSingleThreadedInterpreter(program)
+	q, names, err := i.ParseProcesses(*goal)
+	if err != nil {
+		return err
+	}
+	d := newDebugger(i, names, os.Stdout)
+	d.run(q, os.Stdin)
+	return nil
+}
+
+func (d *debugger) run(initial []process, in io.Reader) {
+	i := d.i
+	d.async = &loopAsync{done: make(chan asyncResult), halt: i.halt, early: map[uint64][]asyncResult{}}
+	i.beginRun(d.async)
+	defer i.endRun()
+	for _, p := range initial {
+		i.putProcess(i.spawn(p))
+	}
+	d.showNext()
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(d.out, "(sdb) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(d.out)
+			return
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		arg := ""
+		if len(fields) > 1 {
+			arg = fields[1]
+		}
+		switch fields[0] {
+		case "s", "step":
+			n := 1
+			if arg != "" {
+				var err error
+				if n, err = strconv.Atoi(arg); err != nil {
+					fmt.Fprintf(d.out, "not a number: %s\n", arg)
+					continue
+				}
+			}
+			for range n {
+				if !d.step() {
+					break
+				}
+			}
+			d.showNext()
+		case "c", "continue":
+			d.watchHit = false
+			for d.step() {
+				if d.shouldBreak() {
+					break
+				}
+			}
+			d.showNext()
+		case "b", "break":
+			k, err := parseProcKey(arg)
+			if err != nil {
+				fmt.Fprintln(d.out, err)
+				continue
+			}
+			d.breaks[k] = true
+			fmt.Fprintf(d.out, "breakpoint on %s\n", arg)
+		case "w", "watch":
+			v, ok := d.names[arg]
+			if !ok {
+				fmt.Fprintf(d.out, "unknown query variable %s\n", arg)
+				continue
+			}
+			if _, bound := i.bindings[v]; bound {
+				fmt.Fprintf(d.out, "%s is already bound\n", arg)
+				continue
+			}
+			d.watches[arg] = true
+			fmt.Fprintf(d.out, "watching %s\n", arg)
+		case "d", "delete":
+			if k, err := parseProcKey(arg); err == nil {
+				delete(d.breaks, k)
+			}
+			delete(d.watches, arg)
+		case "pool":
+			for n := len(i.pool) - 1; n >= 0; n-- {
+				fmt.Fprintf(d.out, "  %s\n", i.pool[n])
+			}
+		case "susp":
+			vars := []variable{}
+			for v := range i.suspensions {
+				vars = append(vars, v)
+			}
+			sort.Slice(vars, func(a, b int) bool { return vars[a] < vars[b] })
+			for _, v := range vars {
+				for _, s := range i.suspensions[v] {
+					if !s.woken {
+						fmt.Fprintf(d.out, "  %s: %s\n", v.PrintExpression(), s.p)
+					}
+				}
+			}
+		case "p", "print":
+			v, ok := d.names[arg]
+			if !ok {
+				fmt.Fprintf(d.out, "unknown query variable %s\n", arg)
+				continue
+			}
+			fmt.Fprintf(d.out, "%s = %s\n", arg, walkDeep(i.bindings, v).PrintExpression())
+		case "q", "quit":
+			return
+		case "h", "help":
+			fmt.Fprint(d.out, debugHelp)
+		default:
+			fmt.Fprintf(d.out, "unknown command %s, try help\n", fields[0])
+		}
+	}
+}
+
+func parseProcKey(s string) (procKey, error) {
+	n := strings.LastIndex(s, "/")
+	if n < 1 {
+		return procKey{}, fmt.Errorf("expected functor/arity but got %q", s)
+	}
+	arity, err := strconv.Atoi(s[n+1:])
+	if err != nil {
+		return procKey{}, fmt.Errorf("expected functor/arity but got %q", s)
+	}
+	return procKey{s[:n], arity}, nil
+}
+
+// step takes a single step and reports on it; returns false if the pool was empty
+func (d *debugger) step() bool {
+	i := d.i
+	p, ok := i.peekProcess()
+	for !ok {
+		if d.async.apply(i, true) {
+			fmt.Fprintln(d.out, "async call returned")
+			p, ok = i.peekProcess()
+			continue
+		}
+		// nothing left to do: ports nobody holds get closed, see ports.go
+		by, theta := i.closePorts(i.suspendedProcesses())
+		if len(theta) == 0 {
+			return false
+		}
+		i.commitBindings(by, i.bindings, theta)
+		fmt.Fprintf(d.out, "closed %d ports\n", len(theta))
+		p, ok = i.peekProcess()
+	}
+	var candidates []rule
+	if !p.isPredefined() {
+		candidates = i.getPossibleRules(i.bindings, p)
+	}
+	clear(d.outcomes)
+	before := map[string]bool{}
+	for name := range d.watches {
+		_, before[name] = i.bindings[d.names[name]]
+	}
+	suspendedBefore := i.numSuspended
+	i.step()
+	d.steps++
+	fmt.Fprintf(d.out, "%d: %s\n", d.steps, p)
+	switch {
+	case p.isPredefined() && i.numSuspended > suspendedBefore:
+		fmt.Fprintln(d.out, "  builtin suspended")
+	case p.isPredefined():
+		fmt.Fprintln(d.out, "  builtin executed")
+	case len(candidates) == 0:
+		fmt.Fprintln(d.out, "  no rules for this process")
+	}
+	for _, r := range candidates {
+		outcome, ok := d.outcomes[r.clause]
+		if !ok {
+			outcome = "not tried"
+		}
+		fmt.Fprintf(d.out, "  %s\n    %s\n", r, outcome)
+	}
+	// so that what is shown next is what the next step takes
+	for d.async.apply(i, false) {
+		fmt.Fprintln(d.out, "async call returned")
+	}
+	for name := range d.watches {
+		if _, bound := i.bindings[d.names[name]]; bound && !before[name] {
+			fmt.Fprintf(d.out, "watch: %s = %s\n", name, walkDeep(i.bindings, d.names[name]).PrintExpression())
+			delete(d.watches, name)
+			d.watchHit = true
+		}
+	}
+	return true
+}
+
+// shouldBreak reports whether continuing should stop before the next process
+func (d *debugger) shouldBreak() bool {
+	if d.watchHit {
+		d.watchHit = false
+		return true
+	}
+	p, ok := d.i.peekProcess()
+	if !ok {
+		return false
+	}
+	if d.breaks[procKey{p.functor, p.arity()}] {
+		fmt.Fprintf(d.out, "breakpoint: %s/%d\n", p.functor, p.arity())
+		return true
+	}
+	return false
+}
+
+func (d *debugger) showNext() {
+	i := d.i
+	p, ok := i.peekProcess()
+	if !ok {
+		if i.numSuspended > 0 {
+			fmt.Fprintf(d.out, "pool is empty: deadlock with %d processes suspended\n", i.numSuspended)
+			return
+		}
+		fmt.Fprintln(d.out, "pool is empty: done")
+		return
+	}
+	fmt.Fprintf(d.out, "next: %s\n", p)
+}
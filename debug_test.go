@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDebugger(t *testing.T) {
+	s := MustParseRules(`
+    member(X,[X1|Rest],R) :-
+        X =\= X1 | member(X,Rest,R).
+    member(X,[X1|_],R) :-
+        X == X1 | R := true.
+    member(_, [], R) :- R := false.`)
+	i := NewSingleThreadedInterpreter(s)
+	q, names := i.MustParseProcesses("member(2, [1,2,3], R)")
+	var out bytes.Buffer
+	d := newDebugger(i, names, &out)
+	d.run(q, strings.NewReader("b :=/2\nw R\nc\npool\nc\np R\nc\n"))
+	got := out.String()
+	for _, want := range []string{
+		"next: member(2,[1|[2|[3]]],v#0)",
+		"breakpoint on :=/2",
+		"watching R",
+		"1: member(2,[1|[2|[3]]],v#0)\n  member(v#0,[v#1|v#2],v#3) :- v#0 =\\= v#1 | member(v#0,v#2,v#3).\n    committed\n",
+		"breakpoint: :=/2\nnext: v#",
+		"builtin executed\nwatch: R = true\n",
+		"pool is empty: done",
+		"R = true",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected output to contain %q but got\n%s", want, got)
+		}
+	}
+}
+
+func TestDebuggerTimer(t *testing.T) {
+	i := NewSingleThreadedInterpreter(nil)
+	q, names := i.MustParseProcesses("timer(10, D)")
+	var out bytes.Buffer
+	d := newDebugger(i, names, &out)
+	// the timer is waited for once there is nothing else to do
+	d.run(q, strings.NewReader("c\np D\n"))
+	got := out.String()
+	for _, want := range []string{"async call returned", "D = true"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected output to contain %q but got\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+)
+
+/*
+Foreign procedures are Go functions registered as Strand builtins under a
+name and arity. Every argument is declared either an input or an output.
+The interpreter suspends the process until all of its inputs are fully
+bound, then calls the function with their values converted to Go, in order,
+as Unmarshal does into an interface: numbers are int64, strings string,
+atoms Atom, true and false bool, and lists []any. The function returns one
+value per output, which are converted back by Marshal and bound to the
+output arguments; an output that is bound already has to equal what was
+returned, or the process fails.
+An error fails the process too, and shows up in the failure report.
+
+Foreign procedures run under the scheduler's write lock, so they should be
+quick; register the ones that are not with RegisterAsyncForeign instead.
+Register them before parsing the programs that use them: rules for a builtin
+are rejected when parsed, but rules parsed before the builtin was registered
+are silently hidden by it.
+*/
+
+// Mode says whether a foreign procedure reads or binds an argument
+type Mode uint8
+
+const (
+	In Mode = iota
+	Out
+)
+
+// Atom is a symbol used as data, like stdin, as a Go value
+type Atom string
+
+// ForeignFunc is given the values of the inputs and returns those of the outputs
+type ForeignFunc func(in []any) ([]any, error)
+
+// RegisterForeign makes fn callable from Strand as name/len(modes)
+func RegisterForeign(name string, modes []Mode, fn ForeignFunc) error {
+	return registerForeign(name, modes, fn, false)
+}
+
+func MustRegisterForeign(name string, modes []Mode, fn ForeignFunc) {
+	if err := RegisterForeign(name, modes, fn); err != nil {
+		panic(err)
+	}
+}
+
+func registerForeign(name string, modes []Mode, fn ForeignFunc, async bool) error {
+	k := procKey{name, len(modes)}
+	builtinsMu.Lock()
+	defer builtinsMu.Unlock()
+	if _, ok := builtins[k]; ok {
+		return fmt.Errorf("%s/%d is already a builtin", name, len(modes))
+	}
+	builtins[k] = foreignBuiltin(modes, fn, async)
+	return nil
+}
+
+// unregisterForeign removes name/arity again, for tests that register
+// procedures of their own
+func unregisterForeign(name string, arity int) {
+	builtinsMu.Lock()
+	defer builtinsMu.Unlock()
+	delete(builtins, procKey{name, arity})
+}
+
+func foreignBuiltin(modes []Mode, fn ForeignFunc, async bool) builtinFunc {
+	return func(i *Interpreter, b bindings, p process) (bindings, []process, bool, []variable) {
+		var in []any
+		var suspend []variable
+		for n, m := range modes {
+			if m != In {
+				continue
+			}
+			x := walkDeep(b, p.args[n])
+			suspend = unboundIn(x, suspend)
+			if len(suspend) > 0 {
+				continue
+			}
+			v, err := unmarshalAny(x)
+			if err != nil {
+				i.errs[p.id] = err
+				return nil, nil, false, nil
+			}
+			in = append(in, v)
+		}
+		if len(suspend) > 0 {
+			return nil, nil, false, suspend
+		}
+		if async && i.async != nil {
+			i.startAsync(p, modes, fn, in)
+			return bindings{}, nil, true, nil
+		}
+		out, err := fn(in)
+		theta, ok := i.foreignOutputs(b, p, modes, out, err)
+		if !ok {
+			return nil, nil, false, nil
+		}
+		return theta, nil, true, nil
+	}
+}
+
+// foreignOutputs returns the bindings for the outputs of p, given what its
+// foreign procedure returned, or false if p fails
+func (i *Interpreter) foreignOutputs(b bindings, p process, modes []Mode, out []any, err error) (bindings, bool) {
+	numOut := 0
+	for _, m := range modes {
+		if m == Out {
+			numOut++
+		}
+	}
+	if err == nil && len(out) != numOut {
+		err = fmt.Errorf("%s/%d returned %d values instead of %d", p.functor, p.arity(), len(out), numOut)
+	}
+	if err != nil {
+		i.errs[p.id] = err
+		return nil, false
+	}
+	theta := bindings{}
+	for n, m := range modes {
+		if m != Out {
+			continue
+		}
+		e, err := Marshal(out[0])
+		if err != nil {
+			i.errs[p.id] = err
+			return nil, false
+		}
+		out = out[1:]
+		switch x := walk(b, p.args[n]).(type) {
+		case variable:
+			if y, ok := theta[x]; ok && y != e {
+				return nil, false
+			}
+			theta[x] = e
+		default:
+			if walkDeep(b, x) != e {
+				return nil, false
+			}
+		}
+	}
+	return theta, true
+}
+
+// unboundIn appends the variables in e, which has been walked deep, to vars
+func unboundIn(e expression, vars []variable) []variable {
+	switch t := e.(type) {
+	case variable:
+		return append(vars, t)
+	case list:
+		return unboundIn(t.tail, unboundIn(t.head, vars))
+	case compound:
+		return unboundIn(t.args, vars)
+	}
+	return vars
+}
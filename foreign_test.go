@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// registered once for the whole test binary, however often tests run
+func init() {
+	// greet(Name, Greeting)
+	MustRegisterForeign("greet", []Mode{In, Out}, func(in []any) ([]any, error) {
+		name, ok := in[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string but got %v", in[0])
+		}
+		return []any{"hello " + name}, nil
+	})
+	// sum_list(Xs, Sum, Len)
+	MustRegisterForeign("sum_list", []Mode{In, Out, Out}, func(in []any) ([]any, error) {
+		var sum int64
+		for _, x := range in[0].([]any) {
+			sum += x.(int64)
+		}
+		return []any{sum, len(in[0].([]any))}, nil
+	})
+	// goal_name(Goal, Name)
+	MustRegisterForeign("goal_name", []Mode{In, Out}, func(in []any) ([]any, error) {
+		c, ok := in[0].(Compound)
+		if !ok {
+			return nil, fmt.Errorf("expected a compound term but got %v", in[0])
+		}
+		return []any{Atom(c.Functor)}, nil
+	})
+}
+
+func TestForeign(t *testing.T) {
+	for name, interpret := range schedulers {
+		i := NewInterpreter(nil, 2)
+		// the inputs are bound after the foreign procedures are spawned
+		q, b := i.MustParseProcesses(`greet(N, G), sum_list([1,X,3], S, L), goal_name(add(X), F), N := "world", X := 2`)
+		res, deadlocked, _ := interpret(i, q)
+		if deadlocked {
+			t.Fatalf("%s: deadlocked!\n%s", name, i.Report())
+		}
+		for v, want := range map[string]string{"G": `"hello world"`, "S": "6", "L": "3", "F": "add"} {
+			if got := walkDeep(res, b[v]).PrintExpression(); got != want {
+				t.Errorf("%s: expected %s = %s but got %s", name, v, want, got)
+			}
+		}
+	}
+}
+
+func TestForeignError(t *testing.T) {
+	i := NewSingleThreadedInterpreter(nil)
+	q, _ := i.MustParseProcesses(`greet(42, G)`)
+	i.interpretSinglethreaded(q)
+	if got := i.Report(); !strings.HasPrefix(got, "failed: #1 greet(42,v#0): expected a string but got 42\n") {
+		t.Errorf("expected the error in the report but got\n%s", got)
+	}
+	if err := RegisterForeign("isplus", []Mode{Out, In, In}, nil); err == nil {
+		t.Errorf("expected registering isplus/3 again to fail")
+	}
+}
+
+func TestRuleForBuiltin(t *testing.T) {
+	for _, src := range []string{
+		`merge(Xs, Ys, Zs) :- Zs := Xs.`,
+		`greet(N, G) :- G := N.`,
+	} {
+		if _, err := ParseRules(src); err == nil || !strings.Contains(err.Error(), "is a builtin") {
+			t.Errorf("expected %q to be rejected but got %v", src, err)
+		}
+	}
+	// a different arity is a different procedure
+	if _, err := ParseRules(`greet(N) :- writeln(N).`); err != nil {
+		t.Errorf("expected greet/1 to parse but got %v", err)
+	}
+}
+
+func TestRegisterWhileRunning(t *testing.T) {
+	i := NewInterpreter(templateProgram, 4)
+	q, _ := i.MustParseProcesses("sum([1,2,3,4,5,6,7,8],R)")
+	name := func(n int) string { return fmt.Sprintf("while_running_%d", n) }
+	t.Cleanup(func() {
+		for n := range 20 {
+			unregisterForeign(name(n), 1)
+		}
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for n := range 20 {
+			MustRegisterForeign(name(n), []Mode{In}, func(in []any) ([]any, error) {
+				return nil, nil
+			})
+		}
+	}()
+	if _, deadlocked, _ := i.interpretWorkStealing(q); deadlocked {
+		t.Fatal("deadlocked!")
+	}
+	<-done
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+)
+
+/*
+Goroutine-per-process alternative to interpret: every process runs in its
+own goroutine and unbound variables are futures. A process that has to
+suspend simply blocks until one of the variables it suspends on is bound,
+so there is no pool and no suspensions map; the Go scheduler does the work.
+In Stats, runnable goroutines count as the pool.
+
+Deadlock detection: live counts goroutines that are not blocked on a future.
+When it drops to zero, either nothing is blocked and we are done, or every
+blocked goroutine waits on variables that are still unbound and nobody is
+left to bind them. A goroutine whose future was closed but which has not
+woken up yet is still counted as blocked, so we check its variables too.
+*/
+
+type waiter struct {
+	p    process
+	vars []variable
+}
+
+type futureRun struct {
+	i *Interpreter
+	// guards i.bindings and everything below
+	mu      sync.RWMutex
+	futures map[variable]chan struct{}
+	live    int
+	blocked map[*waiter]struct{}
+	// closed once the run is over; blocked goroutines give up
+	halt       chan struct{}
+	deadlocked bool
+	wg         sync.WaitGroup
+	// set once the run is over; late async results are dropped
+	over bool
+}
+
+// returns bindings, boolean=true if deadlock detected and the run's statistics
+func (i *Interpreter) interpretGoroutines(initial []process) (bindings, bool, Stats) {
+	i.stats.begin()
+	f := &futureRun{
+		i:       i,
+		futures: map[variable]chan struct{}{},
+		blocked: map[*waiter]struct{}{},
+		halt:    make(chan struct{}),
+	}
+	defer i.endRun()
+	f.mu.Lock()
+	i.beginRun(futureAsync{f})
+	for _, p := range initial {
+		f.spawn(p)
+	}
+	if f.live == 0 {
+		close(f.halt)
+	}
+	f.mu.Unlock()
+	go func() {
+		select {
+		case <-i.halt:
+			// blocked processes give up, running ones stop at their next attempt
+			f.mu.Lock()
+			select {
+			case <-f.halt:
+			default:
+				close(f.halt)
+			}
+			f.mu.Unlock()
+		case <-f.halt:
+		}
+	}()
+	<-f.halt
+	f.wg.Wait()
+	f.mu.Lock()
+	f.over = true
+	f.mu.Unlock()
+	if f.deadlocked {
+		return nil, true, i.stats.end()
+	}
+	return i.bindings, false, i.stats.end()
+}
+
+// only call while holding the write lock
+func (f *futureRun) spawn(p process) {
+	p = f.i.spawn(p)
+	f.live++
+	f.i.stats.poolDelta(1)
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.run(p)
+	}()
+}
+
+func (f *futureRun) run(p process) {
+	i := f.i
+	for !i.interrupted() {
+		var ok bool
+		var theta bindings
+		var r1 rule
+		var suspendOn []variable
+		var a attempt
+		if p.isPredefined() {
+			f.mu.Lock()
+			ok, theta, r1, suspendOn, a = i.execute(i.bindings, p)
+		} else {
+			f.mu.RLock()
+			ok, theta, r1, suspendOn, a = i.reduceProcess(0, i.bindings, p)
+			f.mu.RUnlock()
+			f.mu.Lock()
+		}
+		if ok {
+			if f.commit(a, p, r1, theta) {
+				f.exit()
+				f.mu.Unlock()
+				return
+			}
+			// clash: try again
+			f.i.stats.rejected.Add(1)
+			f.mu.Unlock()
+			continue
+		}
+		if len(suspendOn) == 0 {
+			// if no suspensions, this process is guaranteed to never succeed
+			i.outcome(a, p, rule{}, false, nil)
+			i.failed = append(i.failed, stuckProcess{p: p})
+			f.exit()
+			f.mu.Unlock()
+			return
+		}
+		if !f.wait(a, p, suspendOn) {
+			return
+		}
+	}
+}
+
+// only call while holding the write lock; returns false on a clash
+// r is the rule that reduced p in attempt a, empty for builtins
+func (f *futureRun) commit(a attempt, p process, r rule, theta bindings) bool {
+	i := f.i
+	for k := range theta {
+		if _, ok := i.bindings[k]; ok {
+			return false
+		}
+	}
+	i.outcome(a, p, r, true, nil)
+	f.bind(p, theta)
+	for _, q := range r.body {
+		f.spawn(spawnedBy(q, p, r))
+	}
+	return true
+}
+
+// only call while holding the write lock
+func (f *futureRun) bind(by process, theta bindings) {
+	f.i.bind(0, by, f.i.bindings, theta)
+	for k := range theta {
+		if ch, ok := f.futures[k]; ok {
+			close(ch)
+			delete(f.futures, k)
+		}
+	}
+}
+
+// wait is called holding the write lock and releases it. It blocks p until one
+// of vars is bound, and returns false if the run ended in the meantime
+// a is the attempt that suspended p
+func (f *futureRun) wait(a attempt, p process, vars []variable) bool {
+	i := f.i
+	cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(f.halt)}}
+	for _, v := range vars {
+		if _, bound := i.bindings[v]; bound {
+			// bound since we read the bindings: no need to wait
+			f.mu.Unlock()
+			return true
+		}
+		ch, ok := f.futures[v]
+		if !ok {
+			ch = make(chan struct{})
+			f.futures[v] = ch
+		}
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
+	}
+	i.outcome(a, p, rule{}, false, vars)
+	if by, theta := i.demand(vars); len(theta) > 0 {
+		// p was waiting for more input: read it and try again
+		f.bind(by, theta)
+		f.mu.Unlock()
+		return true
+	}
+	w := &waiter{p: p, vars: vars}
+	f.blocked[w] = struct{}{}
+	i.stats.suspendedDelta(1)
+	f.exit()
+	f.mu.Unlock()
+
+	chosen, _, _ := reflect.Select(cases)
+	if chosen == 0 {
+		return false
+	}
+	f.mu.Lock()
+	delete(f.blocked, w)
+	i.stats.suspendedDelta(-1)
+	i.stats.wakeups.Add(1)
+	f.live++
+	i.stats.poolDelta(1)
+	f.mu.Unlock()
+	return true
+}
+
+// only call while holding the write lock
+func (f *futureRun) exit() {
+	f.live--
+	f.i.stats.poolDelta(-1)
+	if f.live > 0 {
+		return
+	}
+	for {
+		for w := range f.blocked {
+			for _, v := range w.vars {
+				if _, bound := f.i.bindings[v]; bound {
+					// about to wake up
+					return
+				}
+			}
+		}
+		// nobody can send to these anymore
+		by, theta := f.i.closePorts(f.suspended())
+		if len(theta) == 0 {
+			break
+		}
+		f.bind(by, theta)
+	}
+	select {
+	case <-f.halt:
+		return
+	default:
+	}
+	f.deadlocked = len(f.blocked) > 0
+	f.i.stuck = append(f.i.stuck, f.suspended()...)
+	close(f.halt)
+}
+
+func (f *futureRun) suspended() []stuckProcess {
+	var stuck []stuckProcess
+	for w := range f.blocked {
+		stuck = append(stuck, stuckProcess{w.p, w.vars})
+	}
+	return stuck
+}
@@ -0,0 +1,98 @@
+package main
+
+/*
+Clause index, built once when the interpreter is created.
+Rules are grouped per functor/arity, and within that per principal type of
+the first head argument: a number value, [], a list cell or an atom.
+A clause whose first argument is a variable can match anything, so it ends up
+in every group. Groups keep the order the clauses had in the program.
+*/
+
+type procKey struct {
+	functor string
+	arity   int
+}
+
+type procedure struct {
+	all []rule
+	// clauses per principal type of the first argument
+	byFirstArg map[expression][]rule
+	// clauses with a variable as first argument; used for unindexed types
+	varFirstArg []rule
+}
+
+type clauseIndex map[procKey]*procedure
+
+func indexProgram(program []rule) clauseIndex {
+	index := clauseIndex{}
+	for _, r := range program {
+		k := procKey{r.head.functor, r.head.arity()}
+		proc, ok := index[k]
+		if !ok {
+			proc = &procedure{byFirstArg: map[expression][]rule{}}
+			index[k] = proc
+		}
+		r.clause = len(proc.all)
+		proc.all = append(proc.all, r)
+		if k.arity == 0 {
+			continue
+		}
+		key, ok := firstArgKey(r.head.args[0])
+		if ok {
+			if _, seen := proc.byFirstArg[key]; !seen {
+				// all variable clauses seen so far go before this one
+				proc.byFirstArg[key] = append([]rule{}, proc.varFirstArg...)
+			}
+			proc.byFirstArg[key] = append(proc.byFirstArg[key], r)
+			continue
+		}
+		proc.varFirstArg = append(proc.varFirstArg, r)
+		for key := range proc.byFirstArg {
+			proc.byFirstArg[key] = append(proc.byFirstArg[key], r)
+		}
+	}
+	return index
+}
+
+// firstArgKey returns the principal type of e used as index key,
+// and false if e is unbound and can therefore match a clause of any type.
+// list cells all share the key list{}, compound terms are keyed by functor and
+// arity, the other keys are the values themselves
+func firstArgKey(e expression) (expression, bool) {
+	switch t := e.(type) {
+	case number, atom, str:
+		return t, true
+	case special:
+		if t == underscore {
+			return nil, false
+		}
+		return t, true
+	case list:
+		return list{}, true
+	case compound:
+		args, _ := listElements(t.args)
+		return compound{functor: t.functor, args: number(len(args))}, true
+	}
+	return nil, false
+}
+
+// returns the rules that can possibly match p given bindings b
+// the returned slice is shared and should not be modified
+func (i *Interpreter) getPossibleRules(b bindings, p process) []rule {
+	proc, ok := i.index[procKey{p.functor, p.arity()}]
+	if !ok {
+		return nil
+	}
+	if p.arity() == 0 {
+		return proc.all
+	}
+	key, ok := firstArgKey(walk(b, p.args[0]))
+	if !ok {
+		// unbound: try everything so we learn what to suspend on
+		return proc.all
+	}
+	if rules, ok := proc.byFirstArg[key]; ok {
+		return rules
+	}
+	return proc.varFirstArg
+}
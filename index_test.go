@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestGetPossibleRules(t *testing.T) {
+	s := MustParseRules(`
+    lookup(1, R) :- R := 10.
+    lookup(2, R) :- R := 20.
+    lookup(X, R) :- R := X.
+    lookup([], R) :- R := 0.
+    lookup([X|_], R) :- R := X.
+    lookup(true, R) :- R := 1.`)
+	i := NewSingleThreadedInterpreter(s)
+	q, _ := i.MustParseProcesses("lookup(1, R), lookup(3, R), lookup([], R), lookup([4], R), lookup(true, R), lookup(X, R)")
+	for n, want := range [][]rule{
+		{s[0], s[2]},
+		{s[2]},
+		{s[2], s[3]},
+		{s[2], s[4]},
+		{s[2], s[5]},
+		s,
+	} {
+		got := i.getPossibleRules(i.bindings, q[n])
+		if len(got) != len(want) {
+			t.Errorf("%d: got %v want %v", n, got, want)
+			continue
+		}
+		for k := range got {
+			if got[k].String() != want[k].String() {
+				t.Errorf("%d: got %v want %v", n, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestClauseOrder(t *testing.T) {
+	s := MustParseRules(`
+    pick(1, R) :- R := a.
+    pick(1, R) :- R := b.
+    pick(1, R) :- R := c.`)
+	for _, e := range engines {
+		i := NewSingleThreadedInterpreter(s)
+		i.engine = e
+		var tried []int
+		i.clauseHook = func(r rule, ok bool, suspendOn []variable) {
+			tried = append(tried, r.clause)
+		}
+		q, _ := i.MustParseProcesses("pick(X, R)")
+		// every clause suspends on X, so every one is tried: all orders should come up
+		orders := map[[3]int]bool{}
+		for range 500 {
+			tried = nil
+			i.reduceProcess(0, i.bindings, q[0])
+			orders[[3]int(tried)] = true
+		}
+		if len(orders) != 6 {
+			t.Errorf("engine %d: expected all 6 clause orders but got %v", e, orders)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+Time travel over a recorded execution: a JSON trace, as written by
+run -trace -trace-format json, is replayed event by event to rebuild the pool,
+bindings and suspensions at any point. Points in time are reduction numbers,
+builtin executions included. The state at reduction n includes the bindings
+and spawns of reduction n itself, ie it is everything before reduction n+1.
+Traces of parallel runs interleave the events of different workers, so there
+the state is as the trace saw it, which can lag behind a commit slightly.
+*/
+
+type history struct {
+	// sorted by seq
+	events []jsonEvent
+}
+
+type procEntry struct {
+	ID      uint64 `json:"id"`
+	Process string `json:"process"`
+	// for ancestry: the rule that reduced this process
+	Rule string `json:"rule,omitempty"`
+}
+
+func (p procEntry) String() string {
+	return fmt.Sprintf("#%d %s", p.ID, p.Process)
+}
+
+type snapshot struct {
+	Reduction   int                    `json:"reduction"`
+	Seq         uint64                 `json:"seq"`
+	Pool        []procEntry            `json:"pool"`
+	Bindings    map[string]string      `json:"bindings"`
+	Suspensions map[string][]procEntry `json:"suspensions"`
+}
+
+const inspectUsage = `queries:
+  state N          pool, bindings and suspensions after reduction N
+  bound VAR        which reduction bound VAR, eg v#42
+  suspended ID     state when process ID first suspended
+  ancestry ID      the chain of processes that spawned process ID`
+
+// inspectCmd answers the query on out
+func inspectCmd(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "answer in JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: strandbeest inspect trace.jsonl [-json] query")
+		fs.PrintDefaults()
+		fmt.Fprintln(fs.Output(), inspectUsage)
+	}
+	file, query, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(query) != 2 {
+		fs.Usage()
+		return fmt.Errorf("inspect: expected a query")
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	h, err := readHistory(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	answer, err := h.query(query[0], query[1])
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return json.NewEncoder(out).Encode(answer)
+	}
+	fmt.Fprint(out, answer)
+	return nil
+}
+
+func readHistory(r io.Reader) (*history, error) {
+	h := &history{}
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		var e jsonEvent
+		if err := dec.Decode(&e); err != nil {
+			return nil, fmt.Errorf("reading trace: %w", err)
+		}
+		h.events = append(h.events, e)
+	}
+	sort.SliceStable(h.events, func(a, b int) bool { return h.events[a].Seq < h.events[b].Seq })
+	return h, nil
+}
+
+func (h *history) query(q, arg string) (fmt.Stringer, error) {
+	switch q {
+	case "state":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("expected a reduction number but got %q", arg)
+		}
+		return h.at(n)
+	case "bound":
+		return h.boundBy(arg)
+	case "suspended", "ancestry":
+		id, err := strconv.ParseUint(strings.TrimPrefix(arg, "#"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected a process id but got %q", arg)
+		}
+		if q == "suspended" {
+			return h.firstSuspend(id)
+		}
+		return h.ancestry(id)
+	}
+	return nil, fmt.Errorf("unknown query %s\n%s", q, inspectUsage)
+}
+
+// state replays the first n events
+func (h *history) state(n int) snapshot {
+	s := snapshot{Bindings: map[string]string{}, Suspensions: map[string][]procEntry{}}
+	pool := map[uint64]procEntry{}
+	for _, e := range h.events[:n] {
+		p := procEntry{ID: e.ID, Process: e.Process}
+		s.Seq = e.Seq
+		switch e.Kind {
+		case "spawn":
+			pool[e.ID] = p
+		case "reduce":
+			s.Reduction++
+			delete(pool, e.ID)
+		case "fail":
+			delete(pool, e.ID)
+		case "suspend":
+			delete(pool, e.ID)
+			for _, v := range e.Vars {
+				s.Suspensions[v] = append(s.Suspensions[v], p)
+			}
+		case "wakeup":
+			// suspended on several variables, but woken only once
+			for v, list := range s.Suspensions {
+				var rest []procEntry
+				for _, q := range list {
+					if q.ID != e.ID {
+						rest = append(rest, q)
+					}
+				}
+				if len(rest) == 0 {
+					delete(s.Suspensions, v)
+					continue
+				}
+				s.Suspensions[v] = rest
+			}
+			pool[e.ID] = p
+		case "bind":
+			s.Bindings[e.Var] = e.Value
+		}
+	}
+	for _, p := range pool {
+		s.Pool = append(s.Pool, p)
+	}
+	sort.Slice(s.Pool, func(a, b int) bool { return s.Pool[a].ID < s.Pool[b].ID })
+	return s
+}
+
+func (h *history) at(reduction int) (snapshot, error) {
+	if reduction < 0 {
+		return snapshot{}, fmt.Errorf("no reduction %d", reduction)
+	}
+	count := 0
+	for n, e := range h.events {
+		if e.Kind != "reduce" {
+			continue
+		}
+		if count == reduction {
+			return h.state(n), nil
+		}
+		count++
+	}
+	if count < reduction {
+		return snapshot{}, fmt.Errorf("trace has only %d reductions", count)
+	}
+	return h.state(len(h.events)), nil
+}
+
+type binding struct {
+	Var   string `json:"var"`
+	Value string `json:"value"`
+	// the reduction of process ID that bound Var
+	Reduction int    `json:"reduction"`
+	ID        uint64 `json:"id"`
+	Process   string `json:"process"`
+	Rule      string `json:"rule,omitempty"`
+}
+
+func (b binding) String() string {
+	s := fmt.Sprintf("%s = %s bound by reduction %d of #%d %s\n", b.Var, b.Value, b.Reduction, b.ID, b.Process)
+	if b.Rule != "" {
+		s += fmt.Sprintf("  using %s\n", b.Rule)
+	}
+	return s
+}
+
+func (h *history) boundBy(v string) (binding, error) {
+	reductions := 0
+	// latest reduce event per process
+	reduced := map[uint64]jsonEvent{}
+	at := map[uint64]int{}
+	for _, e := range h.events {
+		switch e.Kind {
+		case "reduce":
+			reductions++
+			reduced[e.ID] = e
+			at[e.ID] = reductions
+		case "bind":
+			if e.Var != v {
+				continue
+			}
+			b := binding{Var: v, Value: e.Value, ID: e.ID, Process: e.Process}
+			if r, ok := reduced[e.ID]; ok {
+				b.Reduction, b.Rule = at[e.ID], r.Rule
+			}
+			return b, nil
+		}
+	}
+	return binding{}, fmt.Errorf("%s is never bound", v)
+}
+
+type firstSuspension struct {
+	procEntry
+	Vars []string `json:"vars"`
+	// the state right after suspending
+	State snapshot `json:"state"`
+}
+
+func (s firstSuspension) String() string {
+	return fmt.Sprintf("%s first suspended on %s at reduction %d\n%s", s.procEntry, strings.Join(s.Vars, ","), s.State.Reduction, s.State)
+}
+
+func (h *history) firstSuspend(id uint64) (firstSuspension, error) {
+	for n, e := range h.events {
+		if e.Kind == "suspend" && e.ID == id {
+			return firstSuspension{procEntry{ID: id, Process: e.Process}, e.Vars, h.state(n + 1)}, nil
+		}
+	}
+	return firstSuspension{}, fmt.Errorf("process #%d never suspended", id)
+}
+
+// the process asked about first, then its parent etc
+type ancestry []procEntry
+
+func (a ancestry) String() string {
+	var sb strings.Builder
+	for n, p := range a {
+		if n > 0 {
+			sb.WriteString("  spawned by ")
+		}
+		sb.WriteString(p.String())
+		sb.WriteString("\n")
+		if p.Rule != "" {
+			fmt.Fprintf(&sb, "    reduced using %s\n", p.Rule)
+		}
+	}
+	return sb.String()
+}
+
+func (h *history) ancestry(id uint64) (ancestry, error) {
+	spawns := map[uint64]jsonEvent{}
+	rules := map[uint64]string{}
+	for _, e := range h.events {
+		switch e.Kind {
+		case "spawn":
+			spawns[e.ID] = e
+		case "reduce":
+			rules[e.ID] = e.Rule
+		}
+	}
+	var a ancestry
+	for id != 0 {
+		e, ok := spawns[id]
+		if !ok {
+			if len(a) == 0 {
+				return nil, fmt.Errorf("process #%d was never spawned", id)
+			}
+			return nil, fmt.Errorf("trace is missing the spawn of process #%d", id)
+		}
+		a = append(a, procEntry{ID: id, Process: e.Process, Rule: rules[id]})
+		id = e.Parent
+	}
+	return a, nil
+}
+
+func (s snapshot) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "after reduction %d (event %d)\n", s.Reduction, s.Seq)
+	sb.WriteString("pool:\n")
+	for _, p := range s.Pool {
+		fmt.Fprintf(&sb, "  %s\n", p)
+	}
+	sb.WriteString("suspended:\n")
+	for _, v := range sortedVars(s.Suspensions) {
+		for _, p := range s.Suspensions[v] {
+			fmt.Fprintf(&sb, "  %s: %s\n", v, p)
+		}
+	}
+	sb.WriteString("bindings:\n")
+	for _, v := range sortedVars(s.Bindings) {
+		fmt.Fprintf(&sb, "  %s = %s\n", v, s.Bindings[v])
+	}
+	return sb.String()
+}
+
+// sorts v#2 before v#10
+func sortedVars[T any](m map[string]T) []string {
+	vars := []string{}
+	for v := range m {
+		vars = append(vars, v)
+	}
+	sort.Slice(vars, func(a, b int) bool {
+		if len(vars[a]) != len(vars[b]) {
+			return len(vars[a]) < len(vars[b])
+		}
+		return vars[a] < vars[b]
+	})
+	return vars
+}
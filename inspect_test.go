@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runs goal single-threaded with a JSON trace and reads it back
+func recordHistory(t *testing.T, program []rule, goal string) (*history, map[string]variable) {
+	t.Helper()
+	var buf bytes.Buffer
+	i := NewSingleThreadedInterpreter(program)
+	i.SetTracer(NewJSONTracer(&buf))
+	q, names := i.MustParseProcesses(goal)
+	i.interpretSinglethreaded(q)
+	h, err := readHistory(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, names
+}
+
+func TestInspectState(t *testing.T) {
+	h, names := recordHistory(t, templateProgram, "sum([1,2,3],R)")
+	start, err := h.at(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(start.Pool) != 1 || start.Pool[0].ID != 1 || len(start.Bindings) != 0 {
+		t.Errorf("expected only the goal in the pool at the start but got %+v", start)
+	}
+	end, err := h.at(9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(end.Pool) != 0 || len(end.Suspensions) != 0 || end.Reduction != 9 {
+		t.Errorf("expected nothing left at the end but got %+v", end)
+	}
+	r := names["R"].PrintExpression()
+	if _, ok := end.Bindings[r]; !ok {
+		t.Errorf("expected %s to be bound at the end but got %v", r, end.Bindings)
+	}
+	if _, err := h.at(10); err == nil {
+		t.Errorf("expected an error past the last reduction")
+	}
+
+	b, err := h.boundBy(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the assignment at the bottom of the recursion
+	if !strings.Contains(b.Process, ":=") || b.Reduction < 2 || b.Reduction > 9 {
+		t.Errorf("expected an assignment to bind %s but got %+v", r, b)
+	}
+}
+
+func TestInspectAncestry(t *testing.T) {
+	h, _ := recordHistory(t, templateProgram, "sum([1,2,3],R)")
+	// the last process spawned is the := at the bottom of the recursion
+	var last uint64
+	for _, e := range h.events {
+		if e.Kind == "spawn" {
+			last = e.ID
+		}
+	}
+	a, err := h.ancestry(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 6 || !strings.Contains(a[0].Process, ":=") || !strings.HasPrefix(a[4].Process, "sum1(") {
+		t.Errorf("expected := spawned by four sum1 and a sum but got\n%s", a)
+	}
+	if a[len(a)-1].ID != 1 || a[1].Rule == "" {
+		t.Errorf("expected the chain to end at the goal, with rules, but got %s", a)
+	}
+}
+
+func TestInspectSuspended(t *testing.T) {
+	s := MustParseRules(`test(X,Y,Z) :- isplus(Z, X, Y).`)
+	h, _ := recordHistory(t, s, "test(X,Y,Z)")
+	sus, err := h.firstSuspend(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sus.Vars) != 2 || len(sus.State.Pool) != 0 || sus.State.Reduction != 1 {
+		t.Errorf("expected isplus to suspend on two vars after the first reduction but got %+v", sus)
+	}
+	for _, v := range sus.Vars {
+		if got := sus.State.Suspensions[v]; len(got) != 1 || got[0].ID != 2 {
+			t.Errorf("expected process 2 to be suspended on %s but got %v", v, got)
+		}
+	}
+	if _, err := h.firstSuspend(1); err == nil {
+		t.Errorf("expected an error for a process that never suspended")
+	}
+}
+
+func TestInspectArgs(t *testing.T) {
+	var buf bytes.Buffer
+	i := NewSingleThreadedInterpreter(templateProgram)
+	i.SetTracer(NewJSONTracer(&buf))
+	q, _ := i.MustParseProcesses("sum([1,2,3],R)")
+	i.interpretSinglethreaded(q)
+	file := filepath.Join(t.TempDir(), "t.jsonl")
+	if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// the trace file may come before or after the flags
+	for _, args := range [][]string{
+		{file, "-json", "state", "1"},
+		{"-json", file, "state", "1"},
+	} {
+		var out bytes.Buffer
+		if err := inspectCmd(args, &out); err != nil {
+			t.Errorf("%v: %v", args, err)
+			continue
+		}
+		var s snapshot
+		if err := json.Unmarshal(out.Bytes(), &s); err != nil {
+			t.Errorf("%v: expected a JSON snapshot but got %q: %v", args, out.String(), err)
+			continue
+		}
+		if s.Reduction != 1 || len(s.Pool) == 0 {
+			t.Errorf("%v: expected the pool after reduction 1 but got %+v", args, s)
+		}
+	}
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"math/rand/v2"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 /*
@@ -16,11 +21,54 @@ and listening to all of the results of reduce, updating bindings
 type Interpreter struct {
 	sync.Mutex
 	varcounter  int64
+	procCounter atomic.Uint64
 	numWorkers  int
 	program     []rule
+	index       clauseIndex
+	code        compiledProgram
+	engine      engine
 	bindings    bindings
-	pool        sync.Pool
-	suspensions map[variable][]process
+	pool        []process
+	suspensions map[variable][]*suspension
+	// number of processes currently suspended
+	numSuspended int
+	tracer       Tracer
+	traceSeq     atomic.Uint64
+	profiler     *profiler
+	labels       *pprofLabels
+	// called after every attempt at matching a single rule, if set
+	clauseHook func(r rule, ok bool, suspendOn []variable)
+	stats      runStats
+	recorder   *recorder
+	replayer   *replayer
+	// where write and friends print to, see SetOutput
+	out   io.Writer
+	outMu sync.Mutex
+	// what stdin is read from, see SetInput; lazy streams being read
+	// and files being written, see streams.go
+	in      *bufio.Reader
+	inMu    sync.Mutex
+	lazy    map[variable]*lazyStream
+	outputs map[str]*os.File
+	// why a builtin failed, by process id, if there is more to say
+	errs map[uint64]error
+	// set by the scheduler while running, see async.go
+	async asyncHost
+	// streams fed from and read into Go channels, see chanstream.go
+	feeds    []func()
+	watchers map[variable][]*streamWatcher
+	// see observe.go
+	observers map[variable][]*observer
+	// what timer and now go by
+	clock Clock
+	// open ports, by the same lock as the bindings; see ports.go
+	ports map[port]*portStream
+	// processes that failed, and those left suspended if the run deadlocked
+	failed []stuckProcess
+	stuck  []stuckProcess
+	// closed by Interrupt
+	halt     chan struct{}
+	haltOnce sync.Once
 }
 
 // program is assumed static, ie no dynamic rule assertions
@@ -28,110 +76,255 @@ func NewInterpreter(program []rule, numWorkers int) *Interpreter {
 	return &Interpreter{
 		numWorkers:  numWorkers,
 		program:     program,
+		index:       indexProgram(program),
+		code:        compileProgram(program),
 		bindings:    bindings{},
-		suspensions: map[variable][]process{},
+		suspensions: map[variable][]*suspension{},
+		out:         os.Stdout,
+		in:          bufio.NewReader(os.Stdin),
+		errs:        map[uint64]error{},
+		clock:       realClock{},
+		halt:        make(chan struct{}),
 	}
 }
 
 func NewSingleThreadedInterpreter(program []rule) *Interpreter {
 	return &Interpreter{
 		program:     program,
+		index:       indexProgram(program),
+		code:        compileProgram(program),
 		bindings:    bindings{},
-		suspensions: map[variable][]process{},
+		suspensions: map[variable][]*suspension{},
+		out:         os.Stdout,
+		in:          bufio.NewReader(os.Stdin),
+		errs:        map[uint64]error{},
+		clock:       realClock{},
+		halt:        make(chan struct{}),
 	}
 }
 
-// returns bindings and boolean=true if deadlock detected
-func (i *Interpreter) interpretSinglethreaded(initial []process) (bindings, bool) {
+// Interrupt stops the run in progress as soon as the routines running it
+// notice, leaving processes where they are; the run then returns as usual
+func (i *Interpreter) Interrupt() {
+	i.haltOnce.Do(func() { close(i.halt) })
+}
+
+func (i *Interpreter) interrupted() bool {
+	select {
+	case <-i.halt:
+		return true
+	default:
+		return false
+	}
+}
+
+// returns bindings, boolean=true if deadlock detected and the run's statistics
+func (i *Interpreter) interpretSinglethreaded(initial []process) (bindings, bool, Stats) {
+	i.stats.begin()
+	a := &loopAsync{done: make(chan asyncResult), halt: i.halt, early: map[uint64][]asyncResult{}}
+	i.beginRun(a)
+	defer i.endRun()
 	for _, p := range initial {
-		i.putProcess(p)
+		i.putProcess(i.spawn(p))
 	}
-	for {
-		p, ok := i.getProcess()
-		if !ok {
-			break
-		}
-		if p.isPredefined() {
-			theta, ok, suspendOn := i.execute(i.bindings, p)
-			if !ok {
-				if len(suspendOn) == 0 {
-					// if no suspensions, this process is guaranteed to never succeed
-					// don't put the process back into the pool
+	if i.replayer != nil {
+		// results of async calls take effect when the recording says so
+		for !i.interrupted() {
+			for id, ok := i.replayer.asyncNext(); ok; id, ok = i.replayer.asyncNext() {
+				a.applyFor(i, id)
+			}
+			if !i.step() {
+				if by, theta := i.closePorts(i.suspendedProcesses()); len(theta) > 0 {
+					i.commitBindings(by, i.bindings, theta)
 					continue
 				}
-				// suspend processes until one of vars are bound
-				for _, v := range suspendOn {
-					i.suspensions[v] = append(i.suspensions[v], p)
-				}
-				continue
+				break
 			}
-			i.commitBindings(i.bindings, theta)
-			continue
 		}
-		rules := i.getPossibleRules(p)
-		ok, theta, r1, suspendOn := i.reduce(i.bindings, p, rules)
-		if !ok {
-			if len(suspendOn) == 0 {
-				// if no suspensions, this process is guaranteed to never succeed
-				// don't put the process back into the pool
-				continue
-			}
-			// suspend processes until one of vars are bound
-			for _, v := range suspendOn {
-				i.suspensions[v] = append(i.suspensions[v], p)
+		a.drain()
+	} else {
+		for !i.interrupted() {
+			if !i.step() {
+				if a.apply(i, true) {
+					continue
+				}
+				if by, theta := i.closePorts(i.suspendedProcesses()); len(theta) > 0 {
+					i.commitBindings(by, i.bindings, theta)
+					continue
+				}
+				break
 			}
-			continue
+			a.apply(i, false)
 		}
-		i.commitBindings(i.bindings, theta)
-		for _, p := range r1.body {
+	}
+	if i.numSuspended > 0 && !i.interrupted() {
+		i.stuck = i.suspendedProcesses()
+		return nil, true, i.stats.end()
+	}
+	return i.bindings, false, i.stats.end()
+}
+
+// step gets a single process from the pool and executes or reduces it
+// returns false if the pool was empty
+func (i *Interpreter) step() bool {
+	p, ok := i.getProcess()
+	if !ok {
+		return false
+	}
+	var theta bindings
+	var r1 rule
+	var suspendOn []variable
+	var a attempt
+	if p.isPredefined() {
+		ok, theta, r1, suspendOn, a = i.execute(i.bindings, p)
+	} else {
+		ok, theta, r1, suspendOn, a = i.reduceProcess(0, i.bindings, p)
+	}
+	i.outcome(a, p, r1, ok, suspendOn)
+	if !ok {
+		if len(suspendOn) == 0 {
+			// if no suspensions, this process is guaranteed to never succeed
+			// don't put the process back into the pool
+			i.failed = append(i.failed, stuckProcess{p: p})
+			return true
+		}
+		if by, theta := i.demand(suspendOn); len(theta) > 0 {
+			// p was waiting for more input: read it and try again
+			i.commitBindings(by, i.bindings, theta)
 			i.putProcess(p)
+			return true
 		}
+		i.suspend(p, suspendOn)
+		return true
 	}
-	if len(i.suspensions) > 0 {
-		return nil, true
+	i.commitBindings(p, i.bindings, theta)
+	for _, q := range r1.body {
+		i.putProcess(i.spawn(spawnedBy(q, p, r1)))
 	}
-	return i.bindings, false
+	return true
+}
+
+// a process can be suspended on multiple variables,
+// but should only be woken up by the first one that gets bound
+type suspension struct {
+	p     process
+	vars  []variable
+	woken bool
 }
 
 // NOTE: these 3 are only called from main interpreter routine, or there will be trouble!
-func (i *Interpreter) commitBindings(b, theta bindings) {
+func (i *Interpreter) commitBindings(by process, b, theta bindings) {
+	for _, p := range i.bind(0, by, b, theta) {
+		i.putProcess(p)
+	}
+}
+
+// bind adds theta, committed by process by on worker, to b and returns the processes that
+// were suspended on any of the newly bound variables; it is up to the caller to schedule them
+func (i *Interpreter) bind(worker int, by process, b, theta bindings) []process {
+	var woken []process
 	for k, v := range theta {
 		b[k] = v
-		// todo: make sure not to put processes back multiple times!
+		i.trace(Event{Kind: EventBind, Process: by, Var: k, Value: v, Worker: worker})
+		if len(i.watchers) > 0 {
+			i.watch(b, k)
+		}
+		if len(i.observers) > 0 {
+			i.notify(b, k)
+		}
 		if list, ok := i.suspensions[k]; ok {
 			delete(i.suspensions, k)
-			for _, p := range list {
-				i.putProcess(p)
+			for _, s := range list {
+				if s.woken {
+					continue
+				}
+				s.woken = true
+				i.numSuspended--
+				i.stats.suspendedDelta(-1)
+				i.stats.wakeups.Add(1)
+				i.trace(Event{Kind: EventWakeup, Process: s.p, Var: k, Worker: worker})
+				woken = append(woken, s.p)
 			}
 		}
 	}
+	return woken
+}
+
+// suspend p until one of vars is bound
+func (i *Interpreter) suspend(p process, vars []variable) {
+	s := &suspension{p: p, vars: vars}
+	for _, v := range vars {
+		i.suspensions[v] = append(i.suspensions[v], s)
+	}
+	i.numSuspended++
+	i.stats.suspendedDelta(1)
+}
+
+// SetOutput sets where write, writeln, nl and print_stream print to;
+// the default is stdout
+func (i *Interpreter) SetOutput(w io.Writer) {
+	i.out = w
+}
+
+// write is serialized, so whatever the scheduler, output of a single
+// builtin is never interleaved with that of another
+func (i *Interpreter) write(s string) {
+	if len(s) == 0 {
+		return
+	}
+	i.outMu.Lock()
+	defer i.outMu.Unlock()
+	io.WriteString(i.out, s)
+}
+
+// spawn numbers a new process and traces it
+func (i *Interpreter) spawn(p process) process {
+	p.id = i.procCounter.Add(1)
+	e := Event{Kind: EventSpawn, Process: p}
+	if p.origin != nil {
+		e.Parent, e.Rule = p.origin.parent.id, p.origin.rule
+	}
+	i.trace(e)
+	return p
 }
 
 func (i *Interpreter) putProcess(p process) {
-	i.pool.Put(&p)
+	i.pool = append(i.pool, p)
+	i.stats.poolDelta(1)
 }
 
-func (i *Interpreter) getProcess() (process, bool) {
-	p := i.pool.Get()
-	if p == nil {
+// requeueProcess puts p back under everything else in the pool, so a process
+// that could not proceed yet does not keep the others from being tried
+func (i *Interpreter) requeueProcess(p process) {
+	i.pool = append([]process{p}, i.pool...)
+	i.stats.poolDelta(1)
+}
+
+// the process getProcess will return next, if any
+func (i *Interpreter) peekProcess() (process, bool) {
+	if len(i.pool) == 0 {
 		return process{}, false
 	}
-	return *p.(*process), true
+	return i.pool[len(i.pool)-1], true
 }
 
-// as naive as possible; this can get optimised
-func (i *Interpreter) getPossibleRules(p process) []rule {
-	candidates := []rule{}
-	for _, r := range i.program {
-		if r.head.functor != p.functor {
-			continue
-		}
-		if r.head.arity() != p.arity() {
-			continue
+// takes the process put in last, or when replaying the one recorded
+func (i *Interpreter) getProcess() (process, bool) {
+	n := len(i.pool)
+	if n == 0 {
+		return process{}, false
+	}
+	k := n - 1
+	if i.replayer != nil {
+		var ok bool
+		if k, ok = i.replayer.pick(i.pool); !ok {
+			return process{}, false
 		}
-		candidates = append(candidates, r)
 	}
-	return candidates
+	p := i.pool[k]
+	i.pool = append(i.pool[:k], i.pool[k+1:]...)
+	i.stats.poolDelta(-1)
+	return p, true
 }
 
 type work struct {
@@ -140,31 +333,49 @@ type work struct {
 }
 
 type result struct {
-	b         bindings
-	p         process
-	body      []process
+	b bindings
+	p process
+	// the rule that reduced p, see execute for builtins
+	rule      rule
 	success   bool
 	suspendOn []variable
+	attempt   attempt
 }
 
-func (i *Interpreter) interpret(initial []process) bindings {
+// returns bindings and the run's statistics
+func (i *Interpreter) interpret(initial []process) (bindings, Stats) {
+	i.stats.begin()
 	inCh := make(chan work, i.numWorkers)
 	outCh := make(chan result, i.numWorkers)
-	globalBindings := bindings{}
+	globalBindings := i.bindings
+	// results of async calls are applied by this routine, between results
+	a := &loopAsync{done: make(chan asyncResult), halt: i.halt, early: map[uint64][]asyncResult{}}
+	i.beginRun(a)
+	defer i.endRun()
 	for n := 0; n < i.numWorkers; n++ {
-		go i.workReduce(inCh, outCh)
+		// worker 0 is the main interpreter routine
+		go i.workReduce(n+1, inCh, outCh)
 	}
 	for _, p := range initial {
-		i.putProcess(p)
+		i.putProcess(i.spawn(p))
 	}
 	// todo: deadlock detection
 	workInProgress := 0
 	for {
+		a.apply(i, false)
 		p, ok := i.getProcess()
+		if ok && i.interrupted() {
+			// schedule nothing more, only wait for work in progress
+			i.putProcess(p)
+			ok = false
+		}
 		if !ok {
 			// no more work to schedule
 			if workInProgress == 0 {
-				// and not awaiting any scheduled work: we are done
+				// and not awaiting any scheduled work or async call: we are done
+				if a.apply(i, true) {
+					continue
+				}
 				close(inCh)
 				close(outCh)
 				break
@@ -183,15 +394,8 @@ func (i *Interpreter) interpret(initial []process) bindings {
 			workInProgress--
 		default:
 			if p.isPredefined() {
-				theta, ok, suspendOn := i.execute(globalBindings, p)
-				if !ok {
-					if len(suspendOn) == 0 {
-						i.putProcess(p)
-						continue
-					}
-					// todo
-				}
-				outCh <- result{b: theta, p: p, success: true}
+				ok, theta, r, suspendOn, a := i.execute(globalBindings, p)
+				outCh <- result{b: theta, p: p, rule: r, success: ok, suspendOn: suspendOn, attempt: a}
 				workInProgress++
 				continue
 			}
@@ -207,119 +411,117 @@ func (i *Interpreter) interpret(initial []process) bindings {
 			workInProgress++
 		}
 	}
-	return globalBindings
+	return globalBindings, i.stats.end()
 }
 
 func (i *Interpreter) handleResult(globalBindings bindings, res result) {
 	if !res.success {
-		i.putProcess(res.p)
+		// p goes back into the pool to be tried again, unless it was
+		// waiting for input: only then did anything happen to replay
+		if by, theta := i.demand(res.suspendOn); len(theta) > 0 {
+			i.outcome(res.attempt, res.p, rule{}, false, res.suspendOn)
+			i.commitBindings(by, globalBindings, theta)
+		} else {
+			i.report(res.attempt, res.p, rule{}, false, res.suspendOn)
+		}
+		i.requeueProcess(res.p)
 		return
 	}
 	for k := range res.b {
 		if _, ok := globalBindings[k]; ok {
 			// single-assignment means if we find a clash, we return the work
+			i.stats.rejected.Add(1)
 			i.putProcess(res.p)
 			return
 		}
 	}
-	i.commitBindings(globalBindings, res.b)
-	for _, r := range res.body {
-		i.putProcess(r)
+	i.outcome(res.attempt, res.p, res.rule, true, nil)
+	i.commitBindings(res.p, globalBindings, res.b)
+	for _, r := range res.rule.body {
+		i.putProcess(i.spawn(spawnedBy(r, res.p, res.rule)))
 	}
 }
 
-// returns updates, bool indicating success, and which vars to suspend on if any
-func (i *Interpreter) execute(b bindings, p process) (bindings, bool, []variable) {
-	newb := bindings{}
-	switch p.functor {
-	case ":=":
-		// X := Y   % assign Y to X in global bindings
-		// todo: validation, occurs checks, etc..
-		x := walk(b, p.args[0])
-		xvar, ok := x.(variable)
-		if !ok {
-			panic(fmt.Sprintf("expected variable but got %s", x.PrintExpression()))
-		}
-		y := walk(b, p.args[1])
-		newb[xvar] = y
-	case "isplus":
-		// isplus(X,Y,Z)    % X is Y + Z
-		x := walk(b, p.args[0])
-		xvar, ok := x.(variable)
-		if !ok {
-			panic(fmt.Sprintf("expected variable but got %s", x.PrintExpression()))
-		}
-		y := walk(b, p.args[1])
-		z := walk(b, p.args[2])
-		var suspensions []variable
-		if yvar, yok := y.(variable); yok {
-			suspensions = append(suspensions, yvar)
-		}
-		if zvar, zok := z.(variable); zok {
-			suspensions = append(suspensions, zvar)
-		}
-		if len(suspensions) > 0 {
-			return nil, false, suspensions
-		}
-		if _, isNum := y.(number); !isNum {
-			return nil, false, nil
-		}
-		if _, isNum := z.(number); !isNum {
-			return nil, false, nil
-		}
-		newb[xvar] = number(y.(number) + z.(number))
-	default:
-		panic(fmt.Sprintf("unknown predefined process %s", p.functor))
+// execute is reduceProcess for builtins and returns the same: success, updates,
+// a rule and which vars to suspend on if any. The rule is empty, unless the
+// builtin continues as other processes, like print_stream does: then it is
+// p :- continuation, so that the continuation is spawned like any rule body
+func (i *Interpreter) execute(b bindings, p process) (bool, bindings, rule, []variable, attempt) {
+	if i.labels != nil {
+		i.labels.enter(p)
+		defer i.labels.leave()
+	}
+	a := attempt{builtin: true}
+	if i.tracer != nil {
+		a.start = time.Now()
+	}
+	theta, body, ok, suspendOn := i.executeBuiltin(b, p)
+	if i.tracer != nil {
+		a.duration = time.Since(a.start)
+	}
+	var r rule
+	if len(body) > 0 {
+		r = rule{head: p, body: body}
+	}
+	return ok, theta, r, suspendOn, a
+}
+
+// returns updates, processes to continue with, bool indicating success,
+// and which vars to suspend on if any
+func (i *Interpreter) executeBuiltin(b bindings, p process) (bindings, []process, bool, []variable) {
+	f, ok := lookupBuiltin(procKey{p.functor, p.arity()})
+	if !ok {
+		panic(fmt.Sprintf("unknown predefined process %s/%d", p.functor, p.arity()))
 	}
-	return newb, true, nil
+	return f(i, b, p)
 }
 
-func (i *Interpreter) workReduce(inCh <-chan work, outCh chan<- result) {
+func (i *Interpreter) workReduce(worker int, inCh <-chan work, outCh chan<- result) {
 	for w := range inCh {
-		rules := i.getPossibleRules(w.p)
-		ok, theta, r1, sus := i.reduce(w.b, w.p, rules)
+		ok, theta, r1, sus, a := i.reduceProcess(worker, w.b, w.p)
 		if !ok {
-			outCh <- result{p: w.p, success: false, suspendOn: sus}
+			outCh <- result{p: w.p, success: false, suspendOn: sus, attempt: a}
 			continue
 		}
-		outCh <- result{b: theta, p: w.p, body: r1.body, success: true}
+		outCh <- result{b: theta, p: w.p, rule: r1, success: true, attempt: a}
 	}
 }
 
 func (i *Interpreter) reduce(b bindings, p process, rules []rule) (bool, bindings, rule, []variable) {
+	// rules are shared between workers, so shuffle a copy
+	rules = append([]rule(nil), rules...)
 	rand.Shuffle(len(rules), func(i, j int) {
 		rules[i], rules[j] = rules[j], rules[i]
 	})
+	if i.replayer != nil {
+		if c, ok := i.replayer.forcedClause(p); ok {
+			for n, r := range rules {
+				if r.clause == c {
+					rules[0], rules[n] = rules[n], rules[0]
+				}
+			}
+		}
+	}
 	m := map[variable]struct{}{}
-Loop:
 	for _, r := range rules {
 		r1 := i.freshCopy(r)
-		ok, updates, sus := cmatch(b, p, r1)
-		if !ok {
-			if len(sus) == 0 {
-				continue
-			}
-			for _, v := range sus {
-				m[v] = struct{}{}
-			}
-			continue
+		var start time.Time
+		if i.profiler != nil {
+			start = time.Now()
 		}
-		guardsSucceed := true
-		for _, g := range r1.guard {
-			ok, sus := guardMatch(b, updates, g)
-			if !ok {
-				guardsSucceed = false
-				if len(sus) == 0 {
-					continue Loop
-				}
-				for _, v := range sus {
-					m[v] = struct{}{}
-				}
-			}
+		ok, updates, sus := cmatchGuards(b, p, r1)
+		if i.profiler != nil {
+			i.profiler.record(r, ok, sus, time.Since(start))
 		}
-		if guardsSucceed {
+		if i.clauseHook != nil {
+			i.clauseHook(r, ok, sus)
+		}
+		if ok {
 			return true, updates, r1, nil
 		}
+		for _, v := range sus {
+			m[v] = struct{}{}
+		}
 	}
 	var suspend []variable
 	for k := range m {
@@ -328,11 +530,43 @@ Loop:
 	return false, nil, rule{}, suspend
 }
 
+// cmatch followed by the guards of r
+// returns success boolean, updated bindings, and list vars to suspend on if any
+func cmatchGuards(b bindings, p process, r rule) (bool, bindings, []variable) {
+	ok, updates, sus := cmatch(b, p, r)
+	if !ok {
+		return false, nil, sus
+	}
+	m := map[variable]struct{}{}
+	for _, g := range r.guard {
+		ok, sus := guardMatch(b, updates, g)
+		if ok {
+			continue
+		}
+		if len(sus) == 0 {
+			// this guard can never succeed, so neither can the rule
+			return false, nil, nil
+		}
+		for _, v := range sus {
+			m[v] = struct{}{}
+		}
+	}
+	if len(m) == 0 {
+		return true, updates, nil
+	}
+	var suspend []variable
+	for k := range m {
+		suspend = append(suspend, k)
+	}
+	return false, nil, suspend
+}
+
 func (i *Interpreter) fresh() variable {
 	i.Lock()
 	v := variable(i.varcounter)
 	i.varcounter += 1
 	i.Unlock()
+	i.stats.variables.Add(1)
 	return v
 }
 
@@ -351,7 +585,7 @@ func (i *Interpreter) freshCopy(r rule) rule {
 	for n := 0; n < len(r.body); n++ {
 		body[n] = i.replaceFresh(b, r.body[n])
 	}
-	return rule{head: head, guard: guards, body: body}
+	return rule{head: head, guard: guards, body: body, clause: r.clause}
 }
 
 func (i *Interpreter) replaceFresh(b bindings, p process) process {
@@ -377,6 +611,9 @@ func (i *Interpreter) replaceFreshExp(b bindings, e expression) expression {
 			tail: i.replaceFreshExp(b, l.tail),
 		}
 	}
+	if c, ok := e.(compound); ok {
+		return compound{functor: c.functor, args: i.replaceFreshExp(b, c.args)}
+	}
 	return e
 }
 
@@ -408,16 +645,11 @@ func cmatch(base bindings, p process, r rule) (bool, bindings, []variable) {
 
 // returns success boolean and list vars to suspend on if any
 func guardMatch(base, updates bindings, g guard) (bool, []variable) {
-	u := walk(base, walk(updates, g.args[0]))
-	v := walk(base, walk(updates, g.args[1]))
+	// compared by value, so look inside lists too
+	u := walkDeep(base, walkDeep(updates, g.args[0]))
+	v := walkDeep(base, walkDeep(updates, g.args[1]))
 	// guard args have to be fully instantiated, otherwise suspend
-	var suspend []variable
-	if uvar, ok := u.(variable); ok {
-		suspend = append(suspend, uvar)
-	}
-	if vvar, ok := v.(variable); ok {
-		suspend = append(suspend, vvar)
-	}
+	suspend := unboundIn(v, unboundIn(u, nil))
 	if len(suspend) > 0 {
 		return false, suspend
 	}
@@ -462,6 +694,15 @@ func unify(base, updates bindings, u, v expression) (bool, []variable) {
 	if uvar, ok := u.(variable); ok {
 		return false, []variable{uvar}
 	}
+	// compound terms match on functor, then args like lists
+	uComp, uIsComp := u.(compound)
+	vComp, vIsComp := v.(compound)
+	if uIsComp && vIsComp {
+		if uComp.functor != vComp.functor {
+			return false, nil
+		}
+		return unify(base, updates, uComp.args, vComp.args)
+	}
 	// remember, emptylist is a special case!
 	uList, uIsList := u.(list)
 	vList, vIsList := v.(list)
@@ -471,7 +712,8 @@ func unify(base, updates bindings, u, v expression) (bool, []variable) {
 		if p && q {
 			return true, nil
 		}
-		if susp == nil || susq == nil {
+		// either side failing for good fails the whole list
+		if (!p && susp == nil) || (!q && susq == nil) {
 			return false, nil
 		}
 		m := map[variable]struct{}{}
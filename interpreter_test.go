@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"testing"
+	"time"
 )
 
 var (
@@ -68,26 +70,44 @@ func TestCMatch(t *testing.T) {
 	}
 }
 
+var engines = []engine{astEngine, vmEngine}
+
+// every scheduler, as tests run them. The pool cannot tell a deadlock from
+// work still to do and spins on it forever, so tests that expect a deadlock
+// skip it
+var schedulers = map[string]func(i *Interpreter, q []process) (bindings, bool, Stats){
+	"singlethreaded": (*Interpreter).interpretSinglethreaded,
+	"workstealing":   (*Interpreter).interpretWorkStealing,
+	"goroutines":     (*Interpreter).interpretGoroutines,
+	"pool": func(i *Interpreter, q []process) (bindings, bool, Stats) {
+		res, stats := i.interpret(q)
+		return res, false, stats
+	},
+}
+
 func TestInterpretSingleThreaded(t *testing.T) {
-	i := NewSingleThreadedInterpreter(templateProgram)
-	l, r := i.fresh(), i.fresh()
-	q := []process{
-		{functor: "sum", args: []expression{
-			list{head: number(1), tail: l}, r,
-		}},
-		{functor: ":=", args: []expression{
-			l, list{head: number(2), tail: list{head: number(3), tail: emptylist}},
-		}},
-	}
-	res, deadlocked := i.interpretSinglethreaded(q)
-	if deadlocked {
-		t.Fatalf("deadlocked!")
-	}
-	got := walk(res, r)
-	// todo: very seldomly I get this error:
-	// interpreter_test.go:88: expected 6 but got %!s(main.variable=20)
-	if got != number(6) {
-		t.Fatalf("expected 6 but got %s", got)
+	for _, e := range engines {
+		i := NewSingleThreadedInterpreter(templateProgram)
+		i.engine = e
+		l, r := i.fresh(), i.fresh()
+		q := []process{
+			{functor: "sum", args: []expression{
+				list{head: number(1), tail: l}, r,
+			}},
+			{functor: ":=", args: []expression{
+				l, list{head: number(2), tail: list{head: number(3), tail: emptylist}},
+			}},
+		}
+		res, deadlocked, _ := i.interpretSinglethreaded(q)
+		if deadlocked {
+			t.Fatalf("engine %d: deadlocked!", e)
+		}
+		got := walk(res, r)
+		// todo: very seldomly I get this error:
+		// interpreter_test.go:88: expected 6 but got %!s(main.variable=20)
+		if got != number(6) {
+			t.Fatalf("engine %d: expected 6 but got %s", e, got)
+		}
 	}
 }
 
@@ -98,12 +118,15 @@ func TestInterpretSingleThreadedDeadlockOnMatch(t *testing.T) {
     member(X,[X1|_],R) :-
         X == X1 | R := true.
     member(_, [], R) :- R := false.`)
-	i := NewSingleThreadedInterpreter(s)
-	// this would work in Prolog, but not in FGHC (suspends on X)
-	q, _ := i.MustParseProcesses("member(X, [1,2,3], R)")
-	res, deadlocked := i.interpretSinglethreaded(q)
-	if !deadlocked {
-		t.Fatalf("expected deadlock but got %v", res)
+	for _, e := range engines {
+		i := NewSingleThreadedInterpreter(s)
+		i.engine = e
+		// this would work in Prolog, but not in FGHC (suspends on X)
+		q, _ := i.MustParseProcesses("member(X, [1,2,3], R)")
+		res, deadlocked, _ := i.interpretSinglethreaded(q)
+		if !deadlocked {
+			t.Fatalf("engine %d: expected deadlock but got %v", e, res)
+		}
 	}
 }
 
@@ -114,22 +137,178 @@ func TestInterpretSingleThreadedDeadlockOnGuard(t *testing.T) {
     member(X,[X1|_],R) :-
         X == X1 | R := true.
     member(_, [], R) :- R := false.`)
-	i := NewSingleThreadedInterpreter(s)
-	// this would work in Prolog, but not in FGHC (suspends on X)
-	q, _ := i.MustParseProcesses("member(1, [X], R)")
-	res, deadlocked := i.interpretSinglethreaded(q)
-	if !deadlocked {
-		t.Fatalf("expected deadlock but got %v", res)
+	for _, e := range engines {
+		i := NewSingleThreadedInterpreter(s)
+		i.engine = e
+		// this would work in Prolog, but not in FGHC (suspends on X)
+		q, _ := i.MustParseProcesses("member(1, [X], R)")
+		res, deadlocked, _ := i.interpretSinglethreaded(q)
+		if !deadlocked {
+			t.Fatalf("engine %d: expected deadlock but got %v", e, res)
+		}
 	}
 }
 
 func TestInterpretSingleThreadedDeadlockOnPrimitive(t *testing.T) {
 	s := MustParseRules(`test(X,Y) :- isplus(Y, X, 1).`)
-	i := NewSingleThreadedInterpreter(s)
-	// this would work in Prolog, but not in FGHC (suspends on X)
-	q, _ := i.MustParseProcesses("test(X, Y)")
-	res, deadlocked := i.interpretSinglethreaded(q)
-	if !deadlocked {
-		t.Fatalf("expected deadlock but got %v", res)
+	for _, e := range engines {
+		i := NewSingleThreadedInterpreter(s)
+		i.engine = e
+		// this would work in Prolog, but not in FGHC (suspends on X)
+		q, _ := i.MustParseProcesses("test(X, Y)")
+		res, deadlocked, _ := i.interpretSinglethreaded(q)
+		if !deadlocked {
+			t.Fatalf("engine %d: expected deadlock but got %v", e, res)
+		}
+	}
+}
+
+func TestInterpretSingleThreadedMember(t *testing.T) {
+	s := MustParseRules(`
+    member(X,[X1|Rest],R) :-
+        X =\= X1 | member(X,Rest,R).
+    member(X,[X1|_],R) :-
+        X == X1 | R := true.
+    member(_, [], R) :- R := false.`)
+	for _, e := range engines {
+		for _, tt := range []struct {
+			query string
+			want  expression
+		}{
+			{query: "member(2, [1,2,3], R)", want: true_value},
+			{query: "member(4, [1,2,3], R)", want: false_value},
+		} {
+			i := NewSingleThreadedInterpreter(s)
+			i.engine = e
+			q, b := i.MustParseProcesses(tt.query)
+			res, deadlocked, _ := i.interpretSinglethreaded(q)
+			if deadlocked {
+				t.Fatalf("engine %d: %s deadlocked!", e, tt.query)
+			}
+			if got := walk(res, b["R"]); got != tt.want {
+				t.Errorf("engine %d: %s expected %s but got %s", e, tt.query, tt.want.PrintExpression(), got.PrintExpression())
+			}
+		}
+	}
+}
+
+func TestInterpretWorkStealing(t *testing.T) {
+	for _, e := range engines {
+		i := NewInterpreter(templateProgram, 4)
+		i.engine = e
+		q, b := i.MustParseProcesses("sum([1|L],R), L := [2,3,4,5,6,7,8,9,10]")
+		res, deadlocked, _ := i.interpretWorkStealing(q)
+		if deadlocked {
+			t.Fatalf("engine %d: deadlocked!", e)
+		}
+		got := walk(res, b["R"])
+		if got != number(55) {
+			t.Fatalf("engine %d: expected 55 but got %s", e, got.PrintExpression())
+		}
+	}
+}
+
+func TestInterpretWorkStealingDeadlock(t *testing.T) {
+	s := MustParseRules(`test(X,Y) :- isplus(Y, X, 1).`)
+	for _, e := range engines {
+		i := NewInterpreter(s, 4)
+		i.engine = e
+		q, _ := i.MustParseProcesses("test(X, Y)")
+		res, deadlocked, _ := i.interpretWorkStealing(q)
+		if !deadlocked {
+			t.Fatalf("engine %d: expected deadlock but got %v", e, res)
+		}
+	}
+}
+
+func TestInterpretGoroutines(t *testing.T) {
+	for _, e := range engines {
+		i := NewInterpreter(templateProgram, 0)
+		i.engine = e
+		q, b := i.MustParseProcesses("sum([1|L],R), L := [2,3,4,5,6,7,8,9,10]")
+		res, deadlocked, _ := i.interpretGoroutines(q)
+		if deadlocked {
+			t.Fatalf("engine %d: deadlocked!", e)
+		}
+		got := walk(res, b["R"])
+		if got != number(55) {
+			t.Fatalf("engine %d: expected 55 but got %s", e, got.PrintExpression())
+		}
+	}
+}
+
+func TestInterpretGoroutinesDeadlock(t *testing.T) {
+	s := MustParseRules(`
+    member(X,[X1|Rest],R) :-
+        X =\= X1 | member(X,Rest,R).
+    member(X,[X1|_],R) :-
+        X == X1 | R := true.
+    member(_, [], R) :- R := false.`)
+	for _, e := range engines {
+		i := NewInterpreter(s, 0)
+		i.engine = e
+		q, _ := i.MustParseProcesses("member(X, [1,2,3], R)")
+		res, deadlocked, _ := i.interpretGoroutines(q)
+		if !deadlocked {
+			t.Fatalf("engine %d: expected deadlock but got %v", e, res)
+		}
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	s := MustParseRules(`
+    loop(X) :- loop(X).
+    wait(go, R) :- R := go.`)
+	for name, interpret := range schedulers {
+		i := NewInterpreter(s, 4)
+		// runs forever, while wait stays suspended and other workers idle
+		q, _ := i.MustParseProcesses("loop(1), wait(X, R)")
+		done := make(chan bool)
+		go func() {
+			_, deadlocked, stats := interpret(i, q)
+			done <- deadlocked || stats.Reductions == 0
+		}()
+		time.Sleep(10 * time.Millisecond)
+		i.Interrupt()
+		select {
+		case bad := <-done:
+			if bad {
+				t.Errorf("%s: expected the run to stop without a deadlock after reducing", name)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: run did not stop", name)
+		}
+	}
+}
+
+func TestInterruptAsync(t *testing.T) {
+	s := MustParseRules(`loop(X) :- loop(X).`)
+	for name, interpret := range schedulers {
+		clock := NewFakeClock(time.UnixMilli(0))
+		i := NewInterpreter(s, 4)
+		i.SetClock(clock)
+		var log bytes.Buffer
+		i.Record(&log)
+		q, b := i.MustParseProcesses("loop(1), timer(10, D)")
+		done := make(chan bindings)
+		go func() {
+			res, _, _ := interpret(i, q)
+			done <- res
+		}()
+		for clock.Waiting() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		i.Interrupt()
+		res := <-done
+		recorded := log.Len()
+		// the timer goes off after the run is over: nothing may change
+		clock.Advance(10 * time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		if got := walkDeep(res, b["D"]); got != b["D"] {
+			t.Errorf("%s: expected D to stay unbound but got %s", name, got.PrintExpression())
+		}
+		if log.Len() != recorded {
+			t.Errorf("%s: expected nothing recorded after the run but got %s", name, log.String()[recorded:])
+		}
 	}
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	s := MustParseRules(`
+    go(S) :- print_stream(S), copy([1,2,3,4], S).
+    copy([X|Xs], S) :- S := [X|S1], copy(Xs, S1).
+    copy([], S) :- S := [].
+    hello(X) :- writeln(X), X := [1,2].
+    greet(X) :- write(X), X := 7.
+    partial(X) :- T := [2], X := [1|T], writeln(X).
+    pairs(S) :- A := 1, S1 := [], S := [[A]|S1], print_stream(S).`)
+	for name, interpret := range schedulers {
+		for _, e := range engines {
+			// only the order within one process or along a stream is fixed
+			for goal, want := range map[string]string{
+				"go(S)":    "1\n2\n3\n4\n",
+				"hello(X)": "[1|[2]]\n",
+				"greet(X)": "7",
+				"nl":       "\n",
+				// nothing is printed before it is fully bound
+				"partial(X)": "[1|[2]]\n",
+				"pairs(S)":   "[1]\n",
+			} {
+				i := NewInterpreter(s, 4)
+				i.engine = e
+				var buf bytes.Buffer
+				i.SetOutput(&buf)
+				q, _ := i.MustParseProcesses(goal)
+				if _, deadlocked, _ := interpret(i, q); deadlocked {
+					t.Fatalf("%s, engine %d: %s deadlocked!", name, e, goal)
+				}
+				if buf.String() != want {
+					t.Errorf("%s, engine %d: %s printed %q, want %q", name, e, goal, buf.String(), want)
+				}
+			}
+		}
+	}
+}
@@ -51,9 +51,39 @@ Result: R = 6
 
 import (
 	"fmt"
+	"os"
 )
 
+// strandbeest run prog.strand -goal "..."
+// strandbeest build prog.strand -goal "..." -o prog.go
+// strandbeest debug prog.strand -goal "..."
+// strandbeest inspect trace.jsonl state 10
+// without arguments, runs a small demo
 func main() {
+	if len(os.Args) < 2 {
+		demo()
+		return
+	}
+	var err error
+	switch os.Args[1] {
+	case "run":
+		err = runCmd(os.Args[2:])
+	case "build":
+		err = buildCmd(os.Args[2:])
+	case "debug":
+		err = debugCmd(os.Args[2:])
+	case "inspect":
+		err = inspectCmd(os.Args[2:], os.Stdout)
+	default:
+		err = fmt.Errorf("unknown command %q", os.Args[1])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func demo() {
 	s := MustParseRules(`
     sum(L, Sum) :- sum1(L, 0, Sum).
     sum1([X|Xs], A, Sum) :- 
@@ -70,7 +100,7 @@ func main() {
 	q, b := i.MustParseProcesses("sum([1|L],R), L := [2,3]")
 	r := b["R"]
 	fmt.Printf("%s\n", q)
-	res := i.interpret(q)
+	res, _ := i.interpret(q)
 	out := walk(res, r)
 	fmt.Printf("R = %s\n", out.PrintExpression())
 
@@ -89,7 +119,7 @@ func main() {
 	q, b = i.MustParseProcesses("member(2, [1,2,3], R)")
 	r = b["R"]
 	fmt.Printf("%s\n", q)
-	res = i.interpret(q)
+	res, _ = i.interpret(q)
 	out = walk(res, r)
 	fmt.Printf("R = %s\n", out.PrintExpression())
 }
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/*
+Conversion between Go values and Strand terms, for code embedding the
+interpreter. Go ints and uints are numbers, bools are true and false,
+strings are strings and Atom is an atom. Slices and arrays are lists.
+There are no tuples, so a struct is a list of its exported fields in order,
+and a map is a list of [Key, Value] pairs sorted by key. Struct fields can be
+tagged: `strand:"-"` leaves a field out and `strand:",atom"` makes a string
+field an atom rather than a string. A compound term like add(1), such as a
+goal passed around as data, is a Compound.
+
+A term may be partially bound: Unmarshal turns an unbound variable into an
+Unbound when the destination is an interface, and leaves a pointer nil;
+anything else cannot hold a variable. Marshal turns an Unbound back into
+the same variable. Terms to unmarshal have to be walked deep first, so that
+the variables in them are really unbound.
+*/
+
+// Term is a Strand term as handled by Marshal and Unmarshal
+type Term = expression
+
+// Unbound stands in for an unbound variable
+type Unbound struct {
+	Var int64
+}
+
+// Compound is a compound term like add(1) as a Go value
+type Compound struct {
+	Functor string
+	Args    []any
+}
+
+var (
+	termType     = reflect.TypeOf((*Term)(nil)).Elem()
+	unboundType  = reflect.TypeOf(Unbound{})
+	compoundType = reflect.TypeOf(Compound{})
+)
+
+// Marshal returns the Strand term for v
+func Marshal(v any) (Term, error) {
+	if v == nil {
+		return nil, fmt.Errorf("strand: cannot marshal nil")
+	}
+	return marshal(reflect.ValueOf(v), false)
+}
+
+func marshal(v reflect.Value, asAtom bool) (Term, error) {
+	if v.Type().Implements(termType) && v.Kind() != reflect.Interface {
+		return v.Interface().(Term), nil
+	}
+	switch x := v.Interface().(type) {
+	case Unbound:
+		return variable(x.Var), nil
+	case Atom:
+		return atom(x), nil
+	case Compound:
+		if x.Functor == "" {
+			return nil, fmt.Errorf("strand: cannot marshal a compound term without a functor")
+		}
+		args := make([]expression, len(x.Args))
+		for n, a := range x.Args {
+			t, err := Marshal(a)
+			if err != nil {
+				return nil, err
+			}
+			args[n] = t
+		}
+		return compound{functor: x.Functor, args: makeList(args, emptylist)}, nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return number(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("strand: cannot marshal %d: too large for a number", v.Uint())
+		}
+		return number(v.Uint()), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return true_value, nil
+		}
+		return false_value, nil
+	case reflect.String:
+		if asAtom {
+			return atom(v.String()), nil
+		}
+		return str(v.String()), nil
+	case reflect.Slice, reflect.Array:
+		terms := make([]expression, v.Len())
+		for n := range terms {
+			t, err := marshal(v.Index(n), false)
+			if err != nil {
+				return nil, err
+			}
+			terms[n] = t
+		}
+		return makeList(terms, emptylist), nil
+	case reflect.Map:
+		type pair struct {
+			key   string
+			k, el Term
+		}
+		pairs := []pair{}
+		iter := v.MapRange()
+		for iter.Next() {
+			k, err := marshal(iter.Key(), false)
+			if err != nil {
+				return nil, err
+			}
+			el, err := marshal(iter.Value(), false)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, pair{k.PrintExpression(), k, el})
+		}
+		sort.Slice(pairs, func(a, b int) bool { return pairs[a].key < pairs[b].key })
+		terms := make([]expression, len(pairs))
+		for n, p := range pairs {
+			terms[n] = makeList([]expression{p.k, p.el}, emptylist)
+		}
+		return makeList(terms, emptylist), nil
+	case reflect.Struct:
+		terms := []expression{}
+		for _, f := range structFields(v.Type()) {
+			t, err := marshal(v.Field(f.index), f.atom)
+			if err != nil {
+				return nil, err
+			}
+			terms = append(terms, t)
+		}
+		return makeList(terms, emptylist), nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil, fmt.Errorf("strand: cannot marshal nil %s", v.Type())
+		}
+		return marshal(v.Elem(), asAtom)
+	}
+	return nil, fmt.Errorf("strand: cannot marshal %s", v.Type())
+}
+
+type structField struct {
+	index int
+	atom  bool
+}
+
+// the fields of a struct type that make up its term
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for n := 0; n < t.NumField(); n++ {
+		f := t.Field(n)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("strand")
+		if tag == "-" {
+			continue
+		}
+		_, opts, _ := strings.Cut(tag, ",")
+		fields = append(fields, structField{index: n, atom: opts == "atom"})
+	}
+	return fields
+}
+
+// Unmarshal stores the Go value for t in what v points to
+func Unmarshal(t Term, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("strand: cannot unmarshal into %T", v)
+	}
+	return unmarshal(t, rv.Elem())
+}
+
+func unmarshal(t Term, v reflect.Value) error {
+	if v.Type() == termType {
+		v.Set(reflect.ValueOf(&t).Elem())
+		return nil
+	}
+	if x, ok := t.(variable); ok {
+		switch {
+		case v.Kind() == reflect.Pointer:
+			v.SetZero()
+			return nil
+		case v.Type() == unboundType:
+		case v.Kind() == reflect.Interface && v.NumMethod() == 0:
+		default:
+			return cannotUnmarshal(t, v)
+		}
+		v.Set(reflect.ValueOf(Unbound{int64(x)}))
+		return nil
+	}
+	if v.Type() == compoundType {
+		x, ok := t.(compound)
+		if !ok {
+			return cannotUnmarshal(t, v)
+		}
+		c, err := unmarshalAny(x)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(c))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return unmarshal(t, v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() > 0 {
+			return cannotUnmarshal(t, v)
+		}
+		x, err := unmarshalAny(t)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(x))
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := t.(number)
+		if !ok || v.OverflowInt(int64(n)) {
+			return cannotUnmarshal(t, v)
+		}
+		v.SetInt(int64(n))
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := t.(number)
+		if !ok || n < 0 || v.OverflowUint(uint64(n)) {
+			return cannotUnmarshal(t, v)
+		}
+		v.SetUint(uint64(n))
+		return nil
+	case reflect.Bool:
+		switch t {
+		case true_value:
+			v.SetBool(true)
+		case false_value:
+			v.SetBool(false)
+		default:
+			return cannotUnmarshal(t, v)
+		}
+		return nil
+	case reflect.String:
+		switch x := t.(type) {
+		case str:
+			v.SetString(string(x))
+		case atom:
+			v.SetString(string(x))
+		default:
+			return cannotUnmarshal(t, v)
+		}
+		return nil
+	case reflect.Slice:
+		elems, ok := listElements(t)
+		if !ok {
+			return cannotUnmarshal(t, v)
+		}
+		s := reflect.MakeSlice(v.Type(), len(elems), len(elems))
+		for n, e := range elems {
+			if err := unmarshal(e, s.Index(n)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	case reflect.Array:
+		elems, ok := listElements(t)
+		if !ok || len(elems) != v.Len() {
+			return cannotUnmarshal(t, v)
+		}
+		for n, e := range elems {
+			if err := unmarshal(e, v.Index(n)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		elems, ok := listElements(t)
+		if !ok {
+			return cannotUnmarshal(t, v)
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(elems))
+		for _, e := range elems {
+			pair, ok := listElements(e)
+			if !ok || len(pair) != 2 {
+				return cannotUnmarshal(t, v)
+			}
+			k := reflect.New(v.Type().Key()).Elem()
+			if err := unmarshal(pair[0], k); err != nil {
+				return err
+			}
+			el := reflect.New(v.Type().Elem()).Elem()
+			if err := unmarshal(pair[1], el); err != nil {
+				return err
+			}
+			m.SetMapIndex(k, el)
+		}
+		v.Set(m)
+		return nil
+	case reflect.Struct:
+		elems, ok := listElements(t)
+		fields := structFields(v.Type())
+		if !ok || len(elems) != len(fields) {
+			return cannotUnmarshal(t, v)
+		}
+		for n, f := range fields {
+			if err := unmarshal(elems[n], v.Field(f.index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return cannotUnmarshal(t, v)
+}
+
+// unmarshalAny returns the Go value for t when unmarshalling into an interface
+func unmarshalAny(t Term) (any, error) {
+	switch x := t.(type) {
+	case number:
+		return int64(x), nil
+	case str:
+		return string(x), nil
+	case atom:
+		return Atom(x), nil
+	case variable:
+		return Unbound{int64(x)}, nil
+	case list:
+		elems, ok := listElements(t)
+		if !ok {
+			return nil, fmt.Errorf("strand: cannot unmarshal %s: not a list", t.PrintExpression())
+		}
+		out := make([]any, len(elems))
+		for n, e := range elems {
+			v, err := unmarshalAny(e)
+			if err != nil {
+				return nil, err
+			}
+			out[n] = v
+		}
+		return out, nil
+	case compound:
+		args, err := unmarshalAny(x.args)
+		if err != nil {
+			return nil, err
+		}
+		elems, ok := args.([]any)
+		if !ok {
+			return nil, fmt.Errorf("strand: cannot unmarshal %s: arguments are not a list", x.functor)
+		}
+		return Compound{Functor: x.functor, Args: elems}, nil
+	}
+	switch t {
+	case true_value:
+		return true, nil
+	case false_value:
+		return false, nil
+	case emptylist:
+		return []any{}, nil
+	}
+	return nil, fmt.Errorf("strand: cannot unmarshal %s", t.PrintExpression())
+}
+
+// listElements returns the elements of a proper list
+func listElements(t Term) ([]expression, bool) {
+	elems := []expression{}
+	for {
+		switch x := t.(type) {
+		case list:
+			elems = append(elems, x.head)
+			t = x.tail
+			continue
+		}
+		return elems, t == emptylist
+	}
+}
+
+func cannotUnmarshal(t Term, v reflect.Value) error {
+	return fmt.Errorf("strand: cannot unmarshal %s into %s", t.PrintExpression(), v.Type())
+}
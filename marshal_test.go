@@ -0,0 +1,145 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+type order struct {
+	ID     int
+	Status string `strand:",atom"`
+	Items  []string
+	Paid   bool
+	note   string
+	Secret string `strand:"-"`
+}
+
+func TestMarshal(t *testing.T) {
+	for n, tt := range []struct {
+		v    any
+		want string
+	}{
+		{v: 42, want: "42"},
+		{v: uint8(7), want: "7"},
+		{v: true, want: "true"},
+		{v: "hi", want: `"hi"`},
+		{v: Atom("stdin"), want: "stdin"},
+		{v: []int{}, want: "[]"},
+		{v: [2]int{1, 2}, want: "[1|[2]]"},
+		{v: map[string]int{"b": 2, "a": 1}, want: `[["a"|[1]]|[["b"|[2]]]]`},
+		{v: order{ID: 1, Status: "open", Items: []string{"x"}, note: "n", Secret: "s"}, want: `[1|[open|[["x"]|[false]]]]`},
+		{v: &order{ID: 2}, want: `[2|[|[[]|[false]]]]`},
+		{v: []any{1, Unbound{3}}, want: "[1|[v#3]]"},
+		{v: number(5), want: "5"},
+		{v: Compound{"add", []any{1, Atom("x")}}, want: "add(1,x)"},
+	} {
+		got, err := Marshal(tt.v)
+		if err != nil {
+			t.Errorf("%d: %v", n, err)
+			continue
+		}
+		if got.PrintExpression() != tt.want {
+			t.Errorf("%d: got %s want %s", n, got.PrintExpression(), tt.want)
+		}
+	}
+	if _, err := Marshal(func() {}); err == nil {
+		t.Errorf("expected an error marshalling a func")
+	}
+	if _, err := Marshal(uint64(math.MaxInt64) + 1); err == nil {
+		t.Errorf("expected an error marshalling a uint64 too large for a number")
+	}
+	if got, err := Marshal(uint64(math.MaxInt64)); err != nil || got != number(math.MaxInt64) {
+		t.Errorf("expected MaxInt64 but got %v, %v", got, err)
+	}
+	if _, err := Marshal(Compound{Args: []any{1}}); err == nil {
+		t.Errorf("expected an error marshalling a compound without a functor")
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	o := order{ID: 1, Status: "open", Items: []string{"x", "y"}, Paid: true}
+	term, err := Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got order
+	if err := Unmarshal(term, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, o) {
+		t.Errorf("got %+v want %+v", got, o)
+	}
+
+	m := map[string][]int{"a": {1}, "b": {}}
+	term, _ = Marshal(m)
+	var gotm map[string][]int
+	if err := Unmarshal(term, &gotm); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotm, m) {
+		t.Errorf("got %v want %v", gotm, m)
+	}
+
+	// partially bound
+	partial := list{head: number(1), tail: list{head: variable(9), tail: emptylist}}
+	var anys []any
+	if err := Unmarshal(partial, &anys); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(anys, []any{int64(1), Unbound{9}}) {
+		t.Errorf("got %v", anys)
+	}
+	var ptrs []*int
+	if err := Unmarshal(partial, &ptrs); err != nil {
+		t.Fatal(err)
+	}
+	if *ptrs[0] != 1 || ptrs[1] != nil {
+		t.Errorf("expected [1, nil] but got %v", ptrs)
+	}
+	var ints []int
+	if err := Unmarshal(partial, &ints); err == nil {
+		t.Errorf("expected an error unmarshalling a variable into an int")
+	}
+	var raw []Term
+	if err := Unmarshal(partial, &raw); err != nil || raw[1] != variable(9) {
+		t.Errorf("expected the terms themselves but got %v, %v", raw, err)
+	}
+
+	// compound terms, nested and partially bound
+	c := compound{functor: "wrap", args: makeList([]expression{compound{functor: "add", args: makeList([]expression{number(1)}, emptylist)}, variable(4)}, emptylist)}
+	want := Compound{"wrap", []any{Compound{"add", []any{int64(1)}}, Unbound{4}}}
+	var gotc Compound
+	if err := Unmarshal(c, &gotc); err != nil || !reflect.DeepEqual(gotc, want) {
+		t.Errorf("got %v, %v want %v", gotc, err, want)
+	}
+	var gota any
+	if err := Unmarshal(c, &gota); err != nil || !reflect.DeepEqual(gota, want) {
+		t.Errorf("got %v, %v want %v", gota, err, want)
+	}
+	if back, err := Marshal(gotc); err != nil || back != Term(c) {
+		t.Errorf("expected %s back but got %v, %v", c.PrintExpression(), back, err)
+	}
+	if err := Unmarshal(number(1), &gotc); err == nil {
+		t.Errorf("expected an error unmarshalling a number into a Compound")
+	}
+	if err := Unmarshal(compound{functor: "f", args: str("x")}, &gota); err == nil {
+		t.Errorf("expected an error unmarshalling a compound without an argument list")
+	}
+}
+
+func TestUnmarshalResult(t *testing.T) {
+	i := NewSingleThreadedInterpreter(templateProgram)
+	q, b := i.MustParseProcesses("sum([1,2,3], R), L := [R, X]")
+	res, _, _ := i.interpretSinglethreaded(q)
+	var got []any
+	if err := Unmarshal(walkDeep(res, b["L"]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != int64(6) {
+		t.Fatalf("expected [6, X] but got %v", got)
+	}
+	if _, ok := got[1].(Unbound); !ok {
+		t.Errorf("expected X to be unbound but got %v", got[1])
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+/*
+Observers follow a query variable while the run is going, instead of waiting
+for the final bindings. An observer watches every unbound variable reachable
+from the variable it observes; when one of them is bound, it is told which
+and what to, and goes on to watch the unbound variables in the new value.
+So following a stream costs a call per binding, not a walk over the stream.
+A variable bound to another unbound variable, as happens when matching a
+rule head, is not reported: the observer watches the other one instead, and
+reports its binding as that of the variable it knows about.
+Observers are called from bind, under the scheduler's write lock whatever the
+scheduler, so calls are never concurrent and come in the order bindings are
+made. They should be quick and must not call back into the interpreter.
+*/
+
+type observer struct {
+	fn func(bound, value Term)
+	// for each variable watched, the one reachable from the observed
+	// variable it stands for; so none is watched twice either
+	as map[variable]variable
+}
+
+// Observe calls fn whenever v, or any variable reachable from it, is bound,
+// with that variable and its value as far as it is bound at that point;
+// call it before running the goal
+func (i *Interpreter) Observe(v Term, fn func(bound, value Term)) {
+	o := &observer{fn: fn, as: map[variable]variable{}}
+	for _, u := range unboundIn(walkDeep(i.bindings, v), nil) {
+		i.observeAs(o, u, u)
+	}
+}
+
+func (i *Interpreter) observeAs(o *observer, v, as variable) {
+	if _, ok := o.as[v]; ok {
+		return
+	}
+	o.as[v] = as
+	if i.observers == nil {
+		i.observers = map[variable][]*observer{}
+	}
+	i.observers[v] = append(i.observers[v], o)
+}
+
+// notify is called by bind for every variable it binds
+func (i *Interpreter) notify(b bindings, v variable) {
+	obs, ok := i.observers[v]
+	if !ok {
+		return
+	}
+	delete(i.observers, v)
+	value := walkDeep(b, v)
+	for _, o := range obs {
+		if u, ok := value.(variable); ok {
+			i.observeAs(o, u, o.as[v])
+			continue
+		}
+		o.fn(o.as[v], value)
+		for _, u := range unboundIn(value, nil) {
+			i.observeAs(o, u, u)
+		}
+	}
+}
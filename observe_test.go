@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestObserve(t *testing.T) {
+	s := MustParseRules(`
+    copy([X|Xs], S) :- S := [X|S1], copy(Xs, S1).
+    copy([], S) :- S := [].
+    go(S, R) :- copy([1,2,3], S), sum(S, R).
+    sum(L, R) :- sum1(L, 0, R).
+    sum1([X|Xs], A, R) :- isplus(A1, A, X), sum1(Xs, A1, R).
+    sum1([], A, R) :- R := A.`)
+	for name, interpret := range schedulers {
+		for _, e := range engines {
+			i := NewInterpreter(s, 4)
+			i.engine = e
+			q, b := i.MustParseProcesses("go(S, R)")
+			// what the observer was told is enough to rebuild S
+			told := bindings{}
+			i.Observe(b["S"], func(bound, value Term) {
+				told[bound.(variable)] = value
+			})
+			var result []string
+			i.Observe(b["R"], func(bound, value Term) {
+				if bound != b["R"] {
+					t.Errorf("%s engine %d: expected a binding for R but got %s", name, e, bound.PrintExpression())
+				}
+				result = append(result, value.PrintExpression())
+			})
+			if _, deadlocked, _ := interpret(i, q); deadlocked {
+				t.Fatalf("%s engine %d: deadlocked!", name, e)
+			}
+			if got := walkDeep(told, b["S"]).PrintExpression(); got != "[1|[2|[3]]]" {
+				t.Errorf("%s engine %d: observed S = %s", name, e, got)
+			}
+			if got := strings.Join(result, " "); got != "6" {
+				t.Errorf("%s engine %d: observed R = %q", name, e, got)
+			}
+		}
+	}
+}
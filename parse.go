@@ -13,32 +13,51 @@ func (e syntaxError) Error() string {
 }
 
 func MustParseRules(input string) []rule {
+	rules, err := ParseRules(input)
+	if err != nil {
+		panic(err)
+	}
+	return rules
+}
+
+func ParseRules(input string) ([]rule, error) {
 	tokens := tokenize(input)
 	rules := []rule{}
 	for len(tokens) > 0 {
 		r, n, err := parseRule(tokens)
 		if err != nil {
-			panic(err)
+			return nil, err
+		}
+		if r.head.isPredefined() {
+			return nil, syntaxError{r.head.functor + "/" + strconv.Itoa(r.head.arity()) + " is a builtin and cannot be redefined"}
 		}
 		tokens = tokens[n:]
 		rules = append(rules, r)
 	}
-	return rules
+	return rules, nil
 }
 
 func (i *Interpreter) MustParseProcesses(input string) ([]process, map[string]variable) {
+	processes, b, err := i.ParseProcesses(input)
+	if err != nil {
+		panic(err)
+	}
+	return processes, b
+}
+
+func (i *Interpreter) ParseProcesses(input string) ([]process, map[string]variable, error) {
 	tokens := tokenize(input)
 	processes := []process{}
 	b := map[string]variable{}
 	for len(tokens) > 0 {
 		p, n, err := parseProcess(b, tokens)
 		if err != nil {
-			panic(err)
+			return nil, nil, err
 		}
 		processes = append(processes, p)
 		if len(tokens) > n {
 			if tokens[n] != Comma {
-				panic("expected comma")
+				return nil, nil, syntaxError{"expected comma"}
 			}
 			tokens = tokens[n+1:]
 			continue
@@ -48,7 +67,7 @@ func (i *Interpreter) MustParseProcesses(input string) ([]process, map[string]va
 	for range len(b) {
 		i.fresh()
 	}
-	return processes, b
+	return processes, b, nil
 }
 
 // parseRule returns a rule, amount of tokens parsed, and error
@@ -119,6 +138,10 @@ func parseGuards(b map[string]variable, tokens []token) ([]guard, int, error) {
 
 // parseProcess returns a process, amount of tokens parsed, and error
 func parseProcess(b map[string]variable, tokens []token) (process, int, error) {
+	if len(tokens) > 0 && tokens[0].IsSymbol() && (len(tokens) == 1 || tokens[1] == Comma || tokens[1] == Period || tokens[1] == Turnstile) {
+		// process without arguments, like nl
+		return process{functor: string(tokens[0])}, 1, nil
+	}
 	if len(tokens) < 2 {
 		return process{}, 0, syntaxError{"not enough tokens to parse process"}
 	}
@@ -189,6 +212,24 @@ func parseExpression(b map[string]variable, tokens []token) (expression, int, er
 	if tokens[0].IsVariable() {
 		return parseVariable(b, string(tokens[0]))
 	}
+	if tokens[0].IsString() {
+		s, err := strconv.Unquote(string(tokens[0]))
+		if err != nil {
+			return nil, 0, syntaxError{"malformed string " + string(tokens[0])}
+		}
+		return str(s), 1, nil
+	}
+	if tokens[0].IsSymbol() {
+		if len(tokens) > 1 && tokens[1] == OpenParen {
+			// a compound term reads just like a process
+			p, n, err := parseProcess(b, tokens)
+			if err != nil {
+				return nil, 0, err
+			}
+			return compound{functor: p.functor, args: makeList(p.args, emptylist)}, n, nil
+		}
+		return atom(tokens[0]), 1, nil
+	}
 	return nil, 0, syntaxError{"unknown expression"}
 }
 
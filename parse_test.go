@@ -47,6 +47,21 @@ func TestParseExpression(t *testing.T) {
             want:   list{head: variable(0), tail: variable(1)},
             wantN:  5,
         },
+        {
+            tokens: []token{"stdin"},
+            want:   atom("stdin"),
+            wantN:  1,
+        },
+        {
+            tokens: []token{`"a, \"b\""`},
+            want:   str(`a, "b"`),
+            wantN:  1,
+        },
+        {
+            tokens: []token{"add", "(", "1", ",", "X", ")"},
+            want:   compound{functor: "add", args: list{head: number(1), tail: list{head: variable(0), tail: emptylist}}},
+            wantN:  6,
+        },
     }{
         if tt.b == nil {
             tt.b = map[string]variable{}
@@ -110,6 +125,11 @@ func TestParseProcess(t *testing.T) {
             }},
             wantN:  8,
         },
+        {
+            tokens: []token{"nl", ",", "go"},
+            want:   process{functor:"nl"},
+            wantN:  1,
+        },
     }{
         if tt.b == nil {
             tt.b = map[string]variable{}
@@ -206,6 +226,10 @@ func TestTokenize(t *testing.T) {
             input: "A1 is A + X,",
             want : []token{"A1", "is", "A", "+", "X", ","},
         },
+        {
+            input: `read_lines("my file.txt", S)`,
+            want : []token{"read_lines", "(", `"my file.txt"`, ",", "S", ")"},
+        },
     }{
         got := tokenize(tt.input)
         if !reflect.DeepEqual(got, tt.want) {
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+)
+
+/*
+Many-to-one communication. open_port(Port, S) binds Port to a new port, and
+every send(Port, Msg) adds Msg to the end of stream S, in the order the
+sends are executed, so any number of producers can write to one stream
+without a tree of merges in between. A port is closed, ending S with [],
+once nobody can send to it anymore: when the run has nothing left to do
+but wait, and none of the suspended processes holds the port. Ports are
+guarded by the same lock as the bindings.
+
+merge(Xs, Ys, Zs) and merge(Streams, Zs) are the other way to get there,
+see builtins.go.
+*/
+
+type portStream struct {
+	// the process that opened the port, as far as bindings are concerned
+	by process
+	// the end of the stream so far
+	end variable
+}
+
+// openPort returns a new port sending to s, an unbound variable
+func (i *Interpreter) openPort(by process, s variable) port {
+	if i.ports == nil {
+		i.ports = map[port]*portStream{}
+	}
+	// a process only ever opens one
+	pt := port(by.id)
+	i.ports[pt] = &portStream{by: by, end: s}
+	return pt
+}
+
+// send returns the bindings that add msg to the stream of pt
+func (i *Interpreter) send(pt port, msg expression) (bindings, error) {
+	s, ok := i.ports[pt]
+	if !ok {
+		return nil, fmt.Errorf("%s is closed", pt.PrintExpression())
+	}
+	if _, bound := i.bindings[s.end]; bound {
+		delete(i.ports, pt)
+		return nil, fmt.Errorf("stream of %s was bound by someone else", pt.PrintExpression())
+	}
+	tail := i.fresh()
+	theta := bindings{s.end: list{head: msg, tail: tail}}
+	s.end = tail
+	return theta, nil
+}
+
+// closePorts is called by a scheduler once there is nothing left to do but
+// wait; it closes the ports none of the suspended processes hold, and returns
+// the bindings that end their streams and who made them, if any
+func (i *Interpreter) closePorts(suspended []stuckProcess) (process, bindings) {
+	if len(i.ports) == 0 {
+		return process{}, nil
+	}
+	held := map[port]bool{}
+	for _, s := range suspended {
+		for _, arg := range s.p.args {
+			portsIn(walkDeep(i.bindings, arg), held)
+		}
+	}
+	var by process
+	var theta bindings
+	for pt, s := range i.ports {
+		if held[pt] {
+			continue
+		}
+		delete(i.ports, pt)
+		if _, bound := i.bindings[s.end]; bound {
+			continue
+		}
+		if theta == nil {
+			theta = bindings{}
+		}
+		by = s.by
+		theta[s.end] = emptylist
+	}
+	return by, theta
+}
+
+// portsIn adds the ports in e, which has been walked deep, to held
+func portsIn(e expression, held map[port]bool) {
+	switch t := e.(type) {
+	case port:
+		held[t] = true
+	case list:
+		portsIn(t.head, held)
+		portsIn(t.tail, held)
+	case compound:
+		portsIn(t.args, held)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	for _, tt := range []struct {
+		goal string
+		want string
+	}{
+		{"merge([1,2,3], [a,b], Z)", "[1|[a|[2|[b|[3]]]]]"},
+		{"merge([], [a,b], Z)", "[a|[b]]"},
+		{"merge([[1,2],[a],[x,y,z]], Z)", "[1|[a|[x|[2|[y|[z]]]]]]"},
+		{"merge([], Z)", "[]"},
+	} {
+		i := NewSingleThreadedInterpreter(nil)
+		q, b := i.MustParseProcesses(tt.goal)
+		res, deadlocked, _ := i.interpretSinglethreaded(q)
+		if deadlocked {
+			t.Fatalf("%s: deadlocked!\n%s", tt.goal, i.Report())
+		}
+		if got := walkDeep(res, b["Z"]).PrintExpression(); got != tt.want {
+			t.Errorf("%s: expected %s but got %s", tt.goal, tt.want, got)
+		}
+	}
+}
+
+var manyToOneProgram = MustParseRules(`
+    merged(R) :- gen([1,2,3], Xs), gen([4,5], Ys), merge(Xs, Ys, Zs), sum1(Zs, 0, R).
+    ported(R) :- open_port(P, S), produce(P, [1,2,3]), produce(P, [4,5]), sum1(S, 0, R).
+    gen([X|Xs], S) :- S := [X|S1], gen(Xs, S1).
+    gen([], S) :- S := [].
+    produce(P, [X|Xs]) :- send(P, X), produce(P, Xs).
+    produce(P, []) :- P1 := P.
+    later(true, P) :- send(P, 1).
+    sum1([X|Xs], A, R) :- isplus(A1, A, X), sum1(Xs, A1, R).
+    sum1([], A, R) :- R := A.`)
+
+func TestManyToOne(t *testing.T) {
+	for name, interpret := range schedulers {
+		for _, e := range engines {
+			for _, goal := range []string{"merged(R)", "ported(R)"} {
+				if name == "pool" && goal == "ported(R)" {
+					// ports are closed once all that is left is suspended,
+					// which the pool never finds out
+					continue
+				}
+				i := NewInterpreter(manyToOneProgram, 4)
+				i.engine = e
+				q, b := i.MustParseProcesses(goal)
+				res, deadlocked, _ := interpret(i, q)
+				if deadlocked {
+					t.Fatalf("%s engine %d %s: deadlocked!\n%s", name, e, goal, i.Report())
+				}
+				if got := walk(res, b["R"]); got != number(15) {
+					t.Errorf("%s engine %d %s: expected 15 but got %s", name, e, goal, got.PrintExpression())
+				}
+			}
+		}
+	}
+}
+
+func TestPortOrder(t *testing.T) {
+	i := NewSingleThreadedInterpreter(nil)
+	q, b := i.MustParseProcesses("open_port(P, S), send(P, a), send(P, b), send(P, c)")
+	res, deadlocked, _ := i.interpretSinglethreaded(q)
+	if deadlocked {
+		t.Fatalf("deadlocked!\n%s", i.Report())
+	}
+	elems, ok := listElements(walkDeep(res, b["S"]))
+	if !ok {
+		t.Fatalf("expected the stream to be closed but got %s", walkDeep(res, b["S"]).PrintExpression())
+	}
+	var got []string
+	for _, e := range elems {
+		got = append(got, e.PrintExpression())
+	}
+	sort.Strings(got)
+	if len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("expected a, b and c but got %v", got)
+	}
+}
+
+func TestHeldPortStaysOpen(t *testing.T) {
+	// the port could still be sent to once D is bound, so
+	// the consumer has to wait: that is a deadlock
+	i := NewSingleThreadedInterpreter(manyToOneProgram)
+	q, _ := i.MustParseProcesses("open_port(P, S), later(D, P), sum1(S, 0, R)")
+	if _, deadlocked, _ := i.interpretSinglethreaded(q); !deadlocked {
+		t.Errorf("expected a deadlock")
+	}
+}
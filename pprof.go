@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"sync"
+)
+
+/*
+Optional pprof labels: while reducing or executing a process, the goroutine
+doing the work is labelled predicate=functor/arity, so a CPU profile can be
+sliced by Strand predicate (go tool pprof -tagfocus predicate=sum1/3).
+Label contexts are built once per functor/arity and reused.
+When disabled, the cost is a nil check.
+Go has no way to read a goroutine's labels, so the caller passes the context
+whose labels the interpreter's routines run with. Process labels are added to
+those, and they are put back once the process is done.
+*/
+
+type pprofLabels struct {
+	// labels of the routines running the interpreter
+	base context.Context
+	// procKey -> context.Context
+	contexts sync.Map
+}
+
+func (i *Interpreter) EnablePprofLabels(ctx context.Context) {
+	i.labels = &pprofLabels{base: ctx}
+}
+
+func (l *pprofLabels) context(p process) context.Context {
+	k := procKey{p.functor, p.arity()}
+	if ctx, ok := l.contexts.Load(k); ok {
+		return ctx.(context.Context)
+	}
+	ctx := pprof.WithLabels(l.base, pprof.Labels("predicate", fmt.Sprintf("%s/%d", k.functor, k.arity)))
+	actual, _ := l.contexts.LoadOrStore(k, ctx)
+	return actual.(context.Context)
+}
+
+func (l *pprofLabels) enter(p process) {
+	pprof.SetGoroutineLabels(l.context(p))
+}
+
+func (l *pprofLabels) leave() {
+	pprof.SetGoroutineLabels(l.base)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPprofLabels(t *testing.T) {
+	i := NewSingleThreadedInterpreter(templateProgram)
+	var parked string
+	pprof.Do(context.Background(), pprof.Labels("test", "outer"), func(ctx context.Context) {
+		i.EnablePprofLabels(ctx)
+		q, _ := i.MustParseProcesses("sum([1,2,3],R)")
+		if _, deadlocked, _ := i.interpretSinglethreaded(q); deadlocked {
+			t.Fatalf("deadlocked!")
+		}
+		// goroutines inherit labels, so this one shows what we were left with
+		started, ch := make(chan struct{}), make(chan struct{})
+		go pprofParked(started, ch)
+		defer close(ch)
+		<-started
+		var buf bytes.Buffer
+		pprof.Lookup("goroutine").WriteTo(&buf, 1)
+		for _, g := range strings.Split(buf.String(), "\n\n") {
+			if strings.Contains(g, "pprofParked") {
+				parked = g
+			}
+		}
+	})
+	if !strings.Contains(parked, `"test":"outer"`) || strings.Contains(parked, "predicate") {
+		t.Errorf("expected the caller's labels to be restored but got\n%s", parked)
+	}
+	for _, want := range []string{"sum/2", "sum1/3", "isplus/3", ":=/2"} {
+		found := false
+		i.labels.contexts.Range(func(_, ctx any) bool {
+			if got, _ := pprof.Label(ctx.(context.Context), "predicate"); got == want {
+				found = true
+			}
+			return true
+		})
+		if !found {
+			t.Errorf("expected a label for %s", want)
+		}
+	}
+}
+
+func pprofParked(started, ch chan struct{}) {
+	close(started)
+	<-ch
+}
+
+func TestPprofLabelsInProfile(t *testing.T) {
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		t.Skipf("cpu profiling unavailable: %v", err)
+	}
+	nums := make([]string, 1000)
+	for n := range nums {
+		nums[n] = "1"
+	}
+	goal := "sum([" + strings.Join(nums, ",") + "],R)"
+	pprof.Do(context.Background(), pprof.Labels("test", "outer"), func(ctx context.Context) {
+		for start := time.Now(); time.Since(start) < 300*time.Millisecond; {
+			i := NewSingleThreadedInterpreter(templateProgram)
+			i.EnablePprofLabels(ctx)
+			q, _ := i.MustParseProcesses(goal)
+			if _, deadlocked, _ := i.interpretSinglethreaded(q); deadlocked {
+				t.Errorf("deadlocked!")
+				return
+			}
+		}
+	})
+	pprof.StopCPUProfile()
+	r, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prof, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// label keys and values end up in the profile's string table,
+	// but only if a sample carried them
+	for _, want := range []string{"predicate", "sum1/3", "outer"} {
+		if !bytes.Contains(prof, []byte(want)) {
+			t.Errorf("expected label %q in the cpu profile", want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// per rule, identified by functor/arity and clause index, how often it was
+// tried and how each attempt ended, the time spent matching head and guards
+// and the number of processes spawned when it committed
+type ruleProfile struct {
+	tried     int64
+	committed int64
+	suspended int64
+	failed    int64
+	spawned   int64
+	matchTime time.Duration
+}
+
+type profiler struct {
+	sync.Mutex
+	rules map[ruleID]*ruleProfile
+}
+
+type ruleID struct {
+	procKey
+	clause int
+}
+
+func (i *Interpreter) EnableProfiling() {
+	i.profiler = &profiler{rules: map[ruleID]*ruleProfile{}}
+}
+
+func (pr *profiler) rule(r rule) *ruleProfile {
+	id := ruleID{procKey{r.head.functor, r.head.arity()}, r.clause}
+	rp, found := pr.rules[id]
+	if !found {
+		rp = &ruleProfile{}
+		pr.rules[id] = rp
+	}
+	return rp
+}
+
+// record counts an attempt to match r. A match is not counted as committed
+// here, as the scheduler may still reject it, see commit
+func (pr *profiler) record(r rule, ok bool, suspendOn []variable, d time.Duration) {
+	pr.Lock()
+	defer pr.Unlock()
+	rp := pr.rule(r)
+	rp.tried++
+	rp.matchTime += d
+	switch {
+	case ok:
+		// counted by commit
+	case len(suspendOn) > 0:
+		rp.suspended++
+	default:
+		rp.failed++
+	}
+}
+
+// commit counts r committing with its instantiated body
+func (pr *profiler) commit(r rule) {
+	pr.Lock()
+	defer pr.Unlock()
+	rp := pr.rule(r)
+	rp.committed++
+	rp.spawned += int64(len(r.body))
+}
+
+// WriteProfile prints a table with a line per rule, most suspended first
+func (i *Interpreter) WriteProfile(w io.Writer) error {
+	if i.profiler == nil {
+		return fmt.Errorf("profiling not enabled")
+	}
+	pr := i.profiler
+	pr.Lock()
+	defer pr.Unlock()
+	ids := []ruleID{}
+	for id := range pr.rules {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool {
+		ra, rb := pr.rules[ids[a]], pr.rules[ids[b]]
+		if ra.suspended != rb.suspended {
+			return ra.suspended > rb.suspended
+		}
+		if ra.tried != rb.tried {
+			return ra.tried > rb.tried
+		}
+		if ids[a].functor != ids[b].functor {
+			return ids[a].functor < ids[b].functor
+		}
+		if ids[a].arity != ids[b].arity {
+			return ids[a].arity < ids[b].arity
+		}
+		return ids[a].clause < ids[b].clause
+	})
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "rule\tclause\ttried\tcommitted\tsuspended\tfailed\tspawned\tmatch time\t")
+	for _, id := range ids {
+		rp := pr.rules[id]
+		fmt.Fprintf(tw, "%s/%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t\n", id.functor, id.arity, id.clause,
+			rp.tried, rp.committed, rp.suspended, rp.failed, rp.spawned, rp.matchTime)
+	}
+	return tw.Flush()
+}
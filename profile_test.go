@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	for _, e := range engines {
+		i := NewSingleThreadedInterpreter(templateProgram)
+		i.engine = e
+		i.EnableProfiling()
+		q, _ := i.MustParseProcesses("sum([1,2,3],R)")
+		if _, deadlocked, _ := i.interpretSinglethreaded(q); deadlocked {
+			t.Fatalf("engine %d: deadlocked!", e)
+		}
+		// the index makes sure only the matching sum1 clause is ever tried
+		for id, want := range map[ruleID]ruleProfile{
+			{procKey{"sum", 2}, 0}:  {tried: 1, committed: 1, spawned: 1},
+			{procKey{"sum1", 3}, 0}: {tried: 3, committed: 3, spawned: 6},
+			{procKey{"sum1", 3}, 1}: {tried: 1, committed: 1, spawned: 1},
+		} {
+			got := *i.profiler.rules[id]
+			got.matchTime = 0
+			if got != want {
+				t.Errorf("engine %d: %v: got %+v want %+v", e, id, got, want)
+			}
+		}
+		var buf bytes.Buffer
+		if err := i.WriteProfile(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Count(buf.String(), "\n"); lines != 4 {
+			t.Errorf("engine %d: expected header and 3 rules but got\n%s", e, buf.String())
+		}
+	}
+}
+
+func TestProfileSuspended(t *testing.T) {
+	i := NewSingleThreadedInterpreter(templateProgram)
+	i.EnableProfiling()
+	q, _ := i.MustParseProcesses("sum(L,R)")
+	i.interpretSinglethreaded(q)
+	for clause := range 2 {
+		if got := i.profiler.rules[ruleID{procKey{"sum1", 3}, clause}].suspended; got != 1 {
+			t.Errorf("clause %d: expected 1 suspension but got %d", clause, got)
+		}
+	}
+}
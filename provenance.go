@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+Provenance: every process remembers the process whose reduction spawned it
+and the rule whose body it came from, so a report on a failed or deadlocked
+process reads like a call chain, innermost first.
+Direct recursion is collapsed: a process spawned by a recursive call links
+back to where the recursion started, so a loop over a long stream does not
+keep every iteration alive. Other chains, like mutual recursion, are cut
+short once they get longer than maxAncestry, keeping the most recent
+ancestors; reports only show so many of them anyway.
+*/
+
+type origin struct {
+	parent process
+	// the rule that reduced parent
+	rule rule
+	// earlier recursive calls to the same procedure left out
+	// between parent and where the recursion started
+	recursed int
+	// number of links in the chain starting here
+	depth int
+	// parent's own ancestors were cut off
+	cut bool
+}
+
+// chains are cut back to maxReportedAncestry links when they grow past this,
+// so the copying that takes is only done once every so many spawns
+const maxAncestry = 2 * maxReportedAncestry
+
+// spawnedBy returns q as spawned from the body of r, when reducing p
+func spawnedBy(q, p process, r rule) process {
+	o := &origin{parent: p, rule: r}
+	if po := p.origin; po != nil && po.parent.functor == p.functor && po.parent.arity() == p.arity() {
+		// p was spawned by an earlier call to the same procedure
+		o.parent.origin = po.parent.origin
+		o.recursed = po.recursed + 1
+	}
+	o.depth = 1
+	if po := o.parent.origin; po != nil {
+		o.depth = po.depth + 1
+		if o.depth > maxAncestry {
+			o.parent.origin = trim(po, maxReportedAncestry-1)
+			o.depth = maxReportedAncestry
+		}
+	}
+	q.origin = o
+	return q
+}
+
+// trim returns a copy of the first n links of the chain starting at o
+func trim(o *origin, n int) *origin {
+	c := *o
+	c.depth = 1
+	if po := c.parent.origin; po != nil {
+		if n == 1 {
+			c.parent.origin, c.cut = nil, true
+		} else {
+			c.parent.origin = trim(po, n-1)
+			c.depth += c.parent.origin.depth
+		}
+	}
+	return &c
+}
+
+// a process that did not run to completion: it failed,
+// or it was still suspended on vars when the run ended
+type stuckProcess struct {
+	p    process
+	vars []variable
+}
+
+// chains longer than this are cut short in reports
+const maxReportedAncestry = 20
+
+// describe prints p with its arguments as far as they are bound in b,
+// followed by where it came from
+func describe(b bindings, s stuckProcess, err error) string {
+	var sb strings.Builder
+	if len(s.vars) == 0 {
+		fmt.Fprintf(&sb, "failed: #%d %s", s.p.id, resolved(b, s.p))
+		if err != nil {
+			fmt.Fprintf(&sb, ": %v", err)
+		}
+		sb.WriteString("\n")
+	} else {
+		fmt.Fprintf(&sb, "suspended on %s: #%d %s\n", printVars(s.vars), s.p.id, resolved(b, s.p))
+	}
+	o := s.p.origin
+	for n := 0; o != nil; n++ {
+		if n == maxReportedAncestry {
+			sb.WriteString("  ...\n")
+			break
+		}
+		fmt.Fprintf(&sb, "  spawned by #%d %s", o.parent.id, resolved(b, o.parent))
+		if o.recursed > 0 {
+			fmt.Fprintf(&sb, " after %d recursive calls", o.recursed)
+		}
+		fmt.Fprintf(&sb, "\n    using %s\n", o.rule)
+		if o.cut {
+			sb.WriteString("  ...\n")
+		}
+		o = o.parent.origin
+	}
+	return sb.String()
+}
+
+func resolved(b bindings, p process) process {
+	args := make([]expression, len(p.args))
+	for n, arg := range p.args {
+		args[n] = walkDeep(b, arg)
+	}
+	p.args = args
+	return p
+}
+
+// suspendedProcesses lists every process left in the suspensions map
+func (i *Interpreter) suspendedProcesses() []stuckProcess {
+	var stuck []stuckProcess
+	seen := map[*suspension]bool{}
+	for _, list := range i.suspensions {
+		for _, s := range list {
+			if s.woken || seen[s] {
+				continue
+			}
+			seen[s] = true
+			stuck = append(stuck, stuckProcess{s.p, s.vars})
+		}
+	}
+	return stuck
+}
+
+// Report describes every process that failed during the last run and, if it
+// deadlocked, every process left suspended, in the order they were spawned
+func (i *Interpreter) Report() string {
+	stuck := append(append([]stuckProcess{}, i.failed...), i.stuck...)
+	sort.Slice(stuck, func(a, b int) bool { return stuck[a].p.id < stuck[b].p.id })
+	var sb strings.Builder
+	for _, s := range stuck {
+		sb.WriteString(describe(i.bindings, s, i.errs[s.p.id]))
+	}
+	return sb.String()
+}
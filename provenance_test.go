@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReportFailure(t *testing.T) {
+	s := MustParseRules(`
+    go(R) :- count([1,2,3,0], 0, R).
+    count([X|Xs], N, R) :- X =\= 0 | isplus(N1, N, 1), count(Xs, N1, R).
+    count([], N, R) :- R := N.`)
+	for _, e := range engines {
+		i := NewSingleThreadedInterpreter(s)
+		i.engine = e
+		q, _ := i.MustParseProcesses("go(R)")
+		if _, deadlocked, _ := i.interpretSinglethreaded(q); deadlocked {
+			t.Fatalf("engine %d: deadlocked!", e)
+		}
+		got := i.Report()
+		lines := strings.Split(strings.TrimSpace(got), "\n")
+		if len(lines) != 5 {
+			t.Fatalf("engine %d: expected a failure and two ancestors but got\n%s", e, got)
+		}
+		for n, want := range []string{
+			"failed: #8 count([0],3,",
+			"  spawned by #6 count([3|[0]],2,",
+			"    using count([",
+			"  spawned by #1 go(",
+			"    using go(",
+		} {
+			if !strings.HasPrefix(lines[n], want) {
+				t.Errorf("engine %d: expected line %d to start with %q but got\n%s", e, n, want, got)
+			}
+		}
+		// the first two recursive calls are collapsed
+		if !strings.HasSuffix(lines[1], " after 2 recursive calls") {
+			t.Errorf("engine %d: expected recursion to be collapsed but got\n%s", e, got)
+		}
+	}
+}
+
+func TestReportDeadlock(t *testing.T) {
+	for name, interpret := range schedulers {
+		if name == "pool" {
+			continue
+		}
+		i := NewInterpreter(templateProgram, 2)
+		q, _ := i.MustParseProcesses("sum([1,2|T],R)")
+		if _, deadlocked, _ := interpret(i, q); !deadlocked {
+			t.Fatalf("%s: expected deadlock", name)
+		}
+		got := i.Report()
+		if !strings.HasPrefix(got, "suspended on v#0: #6 sum1(v#0,3,v#1)\n  spawned by #4 sum1([2|v#0],1,v#1) after 1 recursive calls\n") {
+			t.Errorf("%s: expected the last sum1 to be suspended on T but got\n%s", name, got)
+		}
+		if !strings.Contains(got, "  spawned by #1 sum([1|[2|v#0]],v#1)\n") {
+			t.Errorf("%s: expected the goal in the chain but got\n%s", name, got)
+		}
+	}
+}
+
+func TestAncestryBounded(t *testing.T) {
+	s := MustParseRules(`
+    ping([_|Xs]) :- pong(Xs).
+    pong([_|Xs]) :- ping(Xs).`)
+	i := NewSingleThreadedInterpreter(s)
+	q, _ := i.MustParseProcesses("ping([" + strings.Repeat("1,", 199) + "1])")
+	i.interpretSinglethreaded(q)
+	if len(i.failed) != 1 {
+		t.Fatalf("expected ping([]) to fail but got\n%s", i.Report())
+	}
+	// mutual recursion is not collapsed, but the chain is cut short
+	n := 0
+	for o := i.failed[0].p.origin; o != nil; o = o.parent.origin {
+		n++
+	}
+	if n > maxAncestry {
+		t.Errorf("expected at most %d ancestors but got %d", maxAncestry, n)
+	}
+	got := i.Report()
+	if lines := strings.Split(strings.TrimSpace(got), "\n"); len(lines) != 2+2*maxReportedAncestry || lines[len(lines)-1] != "  ..." {
+		t.Errorf("expected the report to end in ... after %d ancestors but got\n%s", maxReportedAncestry, got)
+	}
+}
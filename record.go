@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+/*
+Record and replay of the nondeterministic choices made during a run.
+Which process gets reduced next, which clause is tried first and which of
+several parallel reductions gets to commit first all show up in the same
+place: the order in which outcomes take effect. So a recording is simply that
+order, one choice per line: the process (by id) whose reduction or execution
+took effect, how it ended and, for reductions, the clause that committed.
+Attempts that had no effect, like a commit rejected because of a clash, are
+not recorded.
+
+Replay runs single-threaded, whatever scheduler made the recording, taking
+processes from the pool in the recorded order and trying the recorded clause
+first. Process ids are handed out in spawn order, which follows from the order
+of commits, so they line up with the recording. Variable numbers do not when
+the recording was made by parallel workers, but results do.
+The results of async calls (see async.go) taking effect are choices too,
+recorded by the process that made the call; replay applies them in the same
+order, waiting for them where needed. So is the time now/1 reads: it is
+recorded along with the outcome of now, and replay reads it from there.
+*/
+
+type choice struct {
+	Step    uint64 `json:"step"`
+	Process uint64 `json:"process"`
+	Outcome string `json:"outcome"`
+	Clause  int    `json:"clause,omitempty"`
+	// what now/1 read, in milliseconds since the Unix epoch
+	Time *int64 `json:"time,omitempty"`
+}
+
+type recorder struct {
+	sync.Mutex
+	enc  *json.Encoder
+	step uint64
+	// what now/1 read for a process whose outcome is yet to be recorded
+	times map[uint64]int64
+}
+
+// Record writes every choice made from now on to w
+func (i *Interpreter) Record(w io.Writer) {
+	i.recorder = &recorder{enc: json.NewEncoder(w)}
+}
+
+func readChoices(r io.Reader) ([]choice, error) {
+	var choices []choice
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		var c choice
+		if err := dec.Decode(&c); err != nil {
+			return nil, fmt.Errorf("reading recording: %w", err)
+		}
+		choices = append(choices, c)
+	}
+	return choices, nil
+}
+
+// recordOutcome is called through outcome once an attempt to reduce or
+// execute p has taken effect, in the order in which they do
+func (i *Interpreter) recordOutcome(p process, r rule, ok bool, suspendOn []variable) {
+	c := choice{Process: p.id, Outcome: outcomeEvent(p, r, ok, suspendOn).Kind.String()}
+	if ok {
+		c.Clause = r.clause
+	}
+	i.recordChoice(c)
+}
+
+// the outcome recorded when the result of an async call by a process takes effect
+const asyncOutcome = "async"
+
+func (i *Interpreter) recordChoice(c choice) {
+	if i.recorder != nil {
+		i.recorder.Lock()
+		i.recorder.step++
+		c.Step = i.recorder.step
+		if t, ok := i.recorder.times[c.Process]; ok {
+			c.Time = &t
+			delete(i.recorder.times, c.Process)
+		}
+		i.recorder.enc.Encode(c)
+		i.recorder.Unlock()
+	}
+	if i.replayer != nil {
+		i.replayer.check(c)
+	}
+}
+
+type replayer struct {
+	choices []choice
+	// index of the choice being replayed
+	next int
+	err  error
+}
+
+// interpretReplay runs single-threaded, making the same choices as were recorded.
+// returns what interpretSinglethreaded does, or an error if the run no longer
+// matches the recording
+func (i *Interpreter) interpretReplay(initial []process, choices []choice) (bindings, bool, Stats, error) {
+	i.replayer = &replayer{choices: choices, next: -1}
+	res, deadlocked, stats := i.interpretSinglethreaded(initial)
+	r := i.replayer
+	if r.err == nil && r.next < len(r.choices)-1 {
+		r.err = fmt.Errorf("replay diverged at step %d: pool is empty", r.choices[r.next+1].Step)
+	}
+	if r.err != nil {
+		return nil, false, stats, r.err
+	}
+	return res, deadlocked, stats, nil
+}
+
+// pick returns the position in pool of the process to take next,
+// or false if replay is over
+func (r *replayer) pick(pool []process) (int, bool) {
+	if r.err != nil {
+		return 0, false
+	}
+	r.next++
+	if r.next == len(r.choices) {
+		r.err = fmt.Errorf("replay diverged: recording ended with %d processes in the pool", len(pool))
+		return 0, false
+	}
+	c := r.choices[r.next]
+	for n, p := range pool {
+		if p.id == c.Process {
+			return n, true
+		}
+	}
+	r.err = fmt.Errorf("replay diverged at step %d: process %d is not in the pool", c.Step, c.Process)
+	return 0, false
+}
+
+// asyncNext moves on to the next choice if that is the result of an async
+// call taking effect, and returns the process that made the call
+func (r *replayer) asyncNext() (uint64, bool) {
+	if r.err != nil || r.next+1 >= len(r.choices) {
+		return 0, false
+	}
+	c := r.choices[r.next+1]
+	if c.Outcome != asyncOutcome {
+		return 0, false
+	}
+	r.next++
+	return c.Process, true
+}
+
+// clockTime returns the time for now/1 to give p, in milliseconds: the clock's,
+// or the recorded one when replaying; false if the recording has none
+func (i *Interpreter) clockTime(p process) (int64, bool) {
+	if r := i.replayer; r != nil {
+		return r.recordedTime(p)
+	}
+	t := i.clock.Now().UnixMilli()
+	if rec := i.recorder; rec != nil {
+		rec.Lock()
+		if rec.times == nil {
+			rec.times = map[uint64]int64{}
+		}
+		rec.times[p.id] = t
+		rec.Unlock()
+	}
+	return t, true
+}
+
+func (r *replayer) recordedTime(p process) (int64, bool) {
+	if r.err != nil || r.next < 0 || r.next >= len(r.choices) {
+		return 0, false
+	}
+	c := r.choices[r.next]
+	if c.Process != p.id || c.Time == nil {
+		r.err = fmt.Errorf("replay diverged at step %d: no time recorded for process %d", c.Step, p.id)
+		return 0, false
+	}
+	return *c.Time, true
+}
+
+// forcedClause returns the clause to try first when reducing p, if any
+func (r *replayer) forcedClause(p process) (int, bool) {
+	if r.next < 0 || r.next >= len(r.choices) {
+		return 0, false
+	}
+	c := r.choices[r.next]
+	if c.Process != p.id || c.Outcome != EventReduce.String() {
+		return 0, false
+	}
+	return c.Clause, true
+}
+
+func (r *replayer) check(got choice) {
+	if r.err != nil {
+		return
+	}
+	want := r.choices[r.next]
+	if got.Outcome != want.Outcome || got.Clause != want.Clause {
+		r.err = fmt.Errorf("replay diverged at step %d: process %d ended in %s clause %d, recorded %s clause %d",
+			want.Step, want.Process, got.Outcome, got.Clause, want.Outcome, want.Clause)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+var mergeProgram = MustParseRules(`
+    pick(X) :- X := 1.
+    pick(X) :- X := 2.
+    mix([X|Xs], Ys, Zs) :- Zs := [X|Zs1], mix(Xs, Ys, Zs1).
+    mix(Xs, [Y|Ys], Zs) :- Zs := [Y|Zs1], mix(Xs, Ys, Zs1).
+    mix([], Ys, Zs) :- Zs := Ys.
+    mix(Xs, [], Zs) :- Zs := Xs.
+    go(R, S) :- pick(A), pick(B), mix([A,B], [3,4], R), pick(S).`)
+
+func TestRecordReplay(t *testing.T) {
+	for name, interpret := range schedulers {
+		for _, e := range engines {
+			for range 10 {
+				var log bytes.Buffer
+				i := NewInterpreter(mergeProgram, 4)
+				i.engine = e
+				i.Record(&log)
+				q, names := i.MustParseProcesses("go(R,S)")
+				res, deadlocked, _ := interpret(i, q)
+				if deadlocked {
+					t.Fatalf("%s engine %d: deadlocked!", name, e)
+				}
+				want := formatResults(names, res)
+
+				choices, err := readChoices(&log)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// replay using the other engine
+				i = NewSingleThreadedInterpreter(mergeProgram)
+				i.engine = engines[(int(e)+1)%len(engines)]
+				q, names = i.MustParseProcesses("go(R,S)")
+				res, deadlocked, _, err = i.interpretReplay(q, choices)
+				if err != nil || deadlocked {
+					t.Fatalf("%s engine %d: replay failed: %v", name, e, err)
+				}
+				if got := formatResults(names, res); got != want {
+					t.Errorf("%s engine %d: recorded %q but replayed %q", name, e, want, got)
+				}
+			}
+		}
+	}
+}
+
+func TestRecordReplayPoolRetries(t *testing.T) {
+	s := MustParseRules(`wait(1, R) :- R := ok.`)
+	for range 10 {
+		var log bytes.Buffer
+		i := NewInterpreter(s, 2)
+		i.Record(&log)
+		// wait is tried before X is bound, and put back into the pool
+		q, _ := i.MustParseProcesses("X := 1, wait(X, R)")
+		i.interpret(q)
+		choices, err := readChoices(&log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		i = NewSingleThreadedInterpreter(s)
+		q, names := i.MustParseProcesses("X := 1, wait(X, R)")
+		res, _, _, err := i.interpretReplay(q, choices)
+		if err != nil {
+			t.Fatalf("replay failed: %v", err)
+		}
+		if got := formatResults(names, res); !strings.Contains(got, "R = ok") {
+			t.Errorf("expected R = ok but got %q", got)
+		}
+	}
+}
+
+func TestRecordReplayNow(t *testing.T) {
+	var log bytes.Buffer
+	i := NewSingleThreadedInterpreter(nil)
+	i.SetClock(NewFakeClock(time.UnixMilli(1000000)))
+	i.Record(&log)
+	q, _ := i.MustParseProcesses("now(T)")
+	i.interpretSinglethreaded(q)
+	recorded := log.String()
+	choices, err := readChoices(&log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// replay reads the time from the recording, not the clock
+	i = NewSingleThreadedInterpreter(nil)
+	i.SetClock(NewFakeClock(time.UnixMilli(2000000)))
+	q, names := i.MustParseProcesses("now(T)")
+	res, _, _, err := i.interpretReplay(q, choices)
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if got := formatResults(names, res); got != "T = 1000000\n" {
+		t.Errorf("expected the recorded time but got %q", got)
+	}
+	// a recording without the time cannot be replayed
+	choices[0].Time = nil
+	i = NewSingleThreadedInterpreter(nil)
+	q, _ = i.MustParseProcesses("now(T)")
+	if _, _, _, err = i.interpretReplay(q, choices); err == nil || !strings.Contains(err.Error(), "no time recorded") {
+		t.Errorf("expected replay to diverge on %s but got %v", recorded, err)
+	}
+}
+
+func TestReplayDiverged(t *testing.T) {
+	var log bytes.Buffer
+	i := NewSingleThreadedInterpreter(mergeProgram)
+	i.Record(&log)
+	q, _ := i.MustParseProcesses("go(R,S)")
+	i.interpretSinglethreaded(q)
+	choices, err := readChoices(&log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i = NewSingleThreadedInterpreter(mergeProgram)
+	q, _ = i.MustParseProcesses("pick(S)")
+	_, _, _, err = i.interpretReplay(q, choices)
+	if err == nil || !strings.Contains(err.Error(), "replay diverged") {
+		t.Errorf("expected replay to diverge but got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats summarises a run, as returned by every run and by Interpreter.Stats
+type Stats struct {
+	Reductions        int64
+	BuiltinExecutions int64
+	// attempts at reducing or executing a process that had to suspend
+	Suspensions int64
+	Wakeups     int64
+	// attempts that can never succeed
+	FailedProcesses int64
+	// results of parallel reductions rejected because of a binding clash
+	RejectedResults int64
+	PeakPoolSize    int64
+	// peak number of processes suspended at the same time
+	PeakSuspensions    int64
+	VariablesAllocated int64
+	WallTime           time.Duration
+}
+
+func (s Stats) String() string {
+	var sb strings.Builder
+	for _, line := range []struct {
+		name  string
+		value any
+	}{
+		{"reductions", s.Reductions},
+		{"builtin executions", s.BuiltinExecutions},
+		{"suspensions", s.Suspensions},
+		{"wakeups", s.Wakeups},
+		{"failed processes", s.FailedProcesses},
+		{"rejected results", s.RejectedResults},
+		{"peak pool size", s.PeakPoolSize},
+		{"peak suspensions", s.PeakSuspensions},
+		{"variables allocated", s.VariablesAllocated},
+		{"wall time", s.WallTime},
+	} {
+		fmt.Fprintf(&sb, "%-20s %v\n", line.name, line.value)
+	}
+	return sb.String()
+}
+
+// counters are updated from all interpreter routines
+type runStats struct {
+	reductions  atomic.Int64
+	builtins    atomic.Int64
+	suspensions atomic.Int64
+	wakeups     atomic.Int64
+	failed      atomic.Int64
+	rejected    atomic.Int64
+	variables   atomic.Int64
+	poolSize    atomic.Int64
+	peakPool    atomic.Int64
+	suspended   atomic.Int64
+	peakSusp    atomic.Int64
+	// guards start and wall, which Stats may read during a run
+	mu    sync.Mutex
+	start time.Time
+	wall  time.Duration
+}
+
+// Stats returns the statistics of the last run, or of the one in progress
+func (i *Interpreter) Stats() Stats {
+	return i.stats.snapshot()
+}
+
+func (s *runStats) snapshot() Stats {
+	s.mu.Lock()
+	wall := s.wall
+	if wall == 0 && !s.start.IsZero() {
+		wall = time.Since(s.start)
+	}
+	s.mu.Unlock()
+	return Stats{
+		Reductions:         s.reductions.Load(),
+		BuiltinExecutions:  s.builtins.Load(),
+		Suspensions:        s.suspensions.Load(),
+		Wakeups:            s.wakeups.Load(),
+		FailedProcesses:    s.failed.Load(),
+		RejectedResults:    s.rejected.Load(),
+		PeakPoolSize:       s.peakPool.Load(),
+		PeakSuspensions:    s.peakSusp.Load(),
+		VariablesAllocated: s.variables.Load(),
+		WallTime:           wall,
+	}
+}
+
+// begin starts counting from zero for a new run
+func (s *runStats) begin() {
+	for _, c := range []*atomic.Int64{
+		&s.reductions, &s.builtins, &s.suspensions, &s.wakeups, &s.failed, &s.rejected,
+		&s.variables, &s.poolSize, &s.peakPool, &s.suspended, &s.peakSusp,
+	} {
+		c.Store(0)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start = time.Now()
+	s.wall = 0
+}
+
+// end stops the clock and returns the statistics of the run
+func (s *runStats) end() Stats {
+	s.mu.Lock()
+	s.wall = time.Since(s.start)
+	s.mu.Unlock()
+	return s.snapshot()
+}
+
+func (s *runStats) outcome(builtin, ok bool, suspendOn []variable) {
+	switch {
+	case ok && builtin:
+		s.builtins.Add(1)
+	case ok:
+		s.reductions.Add(1)
+	case len(suspendOn) > 0:
+		s.suspensions.Add(1)
+	default:
+		s.failed.Add(1)
+	}
+}
+
+// poolDelta and suspendedDelta track the current size to record the peak
+func (s *runStats) poolDelta(n int64) {
+	raise(&s.peakPool, s.poolSize.Add(n))
+}
+
+func (s *runStats) suspendedDelta(n int64) {
+	raise(&s.peakSusp, s.suspended.Add(n))
+}
+
+func raise(peak *atomic.Int64, v int64) {
+	for {
+		old := peak.Load()
+		if v <= old || peak.CompareAndSwap(old, v) {
+			return
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	for _, e := range engines {
+		i := NewSingleThreadedInterpreter(templateProgram)
+		i.engine = e
+		q, _ := i.MustParseProcesses("sum([1,2,3],R)")
+		_, deadlocked, s := i.interpretSinglethreaded(q)
+		if deadlocked {
+			t.Fatalf("engine %d: deadlocked!", e)
+		}
+		if s != i.Stats() {
+			t.Errorf("engine %d: expected the run's stats %+v but got %+v", e, s, i.Stats())
+		}
+		if s.Reductions != 5 || s.BuiltinExecutions != 4 {
+			t.Errorf("engine %d: expected 5 reductions and 4 builtins but got %+v", e, s)
+		}
+		if s.Wakeups != s.Suspensions || s.PeakSuspensions > s.Suspensions {
+			t.Errorf("engine %d: expected every suspension to be woken but got %+v", e, s)
+		}
+		if s.FailedProcesses != 0 || s.RejectedResults != 0 {
+			t.Errorf("engine %d: expected no failures but got %+v", e, s)
+		}
+		if s.PeakPoolSize < 1 || s.VariablesAllocated < 1 || s.WallTime <= 0 {
+			t.Errorf("engine %d: expected pool, variables and time to be recorded but got %+v", e, s)
+		}
+	}
+}
+
+func TestStatsPerRun(t *testing.T) {
+	i := NewSingleThreadedInterpreter(templateProgram)
+	q, _ := i.MustParseProcesses("sum([1,2,3],R)")
+	i.interpretSinglethreaded(q)
+	// a second run counts from zero
+	q, _ = i.MustParseProcesses("nothing")
+	if _, _, s := i.interpretSinglethreaded(q); s.Reductions != 0 || s.BuiltinExecutions != 0 || s.FailedProcesses != 1 {
+		t.Errorf("expected just 1 failed process but got %+v", s)
+	}
+}
+
+func TestStatsSuspendedOnce(t *testing.T) {
+	s := MustParseRules(`test(X,Y,Z) :- isplus(Z, X, Y).`)
+	i := NewSingleThreadedInterpreter(s)
+	q, b := i.MustParseProcesses("test(X,Y,Z)")
+	if _, deadlocked, _ := i.interpretSinglethreaded(q); !deadlocked {
+		t.Fatalf("expected deadlock")
+	}
+	if got := i.Stats().PeakSuspensions; got != 1 {
+		t.Fatalf("expected 1 suspended process but got %d", got)
+	}
+	// suspended on both X and Y, but should only be woken once
+	woken := i.bind(0, process{}, i.bindings, bindings{b["X"]: number(1)})
+	woken = append(woken, i.bind(0, process{}, i.bindings, bindings{b["Y"]: number(2)})...)
+	if len(woken) != 1 || i.Stats().Wakeups != 1 {
+		t.Errorf("expected a single wakeup but got %v", woken)
+	}
+}
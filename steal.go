@@ -0,0 +1,298 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+/*
+A work-stealing alternative to interpret, without a main routine owning the pool:
+- each of numWorkers workers owns a deque of processes
+- spawned body processes and woken processes are pushed onto the local deque
+and popped from the same end (LIFO); an idle worker steals from the other end
+of someone else's deque
+- bindings and suspensions are shared between workers. Reductions read them
+under a read lock, commits take the write lock and reject clashes, just like
+handleResult does for the pool-based interpreter
+- active counts processes that are either queued in a deque or being worked on.
+Once it drops to zero, all deques are empty and no running reduction is left
+that could wake a suspended process: we are done, or deadlocked if anything
+is still suspended
+- a worker that finds nothing to do waits until something is pushed, or
+active drops to zero, rather than spinning
+*/
+
+type deque struct {
+	sync.Mutex
+	items []process
+}
+
+func (d *deque) pushBottom(p process) {
+	d.Lock()
+	d.items = append(d.items, p)
+	d.Unlock()
+}
+
+func (d *deque) popBottom() (process, bool) {
+	d.Lock()
+	defer d.Unlock()
+	n := len(d.items)
+	if n == 0 {
+		return process{}, false
+	}
+	p := d.items[n-1]
+	d.items = d.items[:n-1]
+	return p, true
+}
+
+func (d *deque) popTop() (process, bool) {
+	d.Lock()
+	defer d.Unlock()
+	if len(d.items) == 0 {
+		return process{}, false
+	}
+	p := d.items[0]
+	d.items = d.items[1:]
+	return p, true
+}
+
+type stealScheduler struct {
+	i      *Interpreter
+	deques []*deque
+	active atomic.Int64
+	// guards i.bindings and i.suspensions
+	mu sync.RWMutex
+	// idle workers wait on wakeup; sleeping counts them
+	idle     sync.Mutex
+	wakeup   *sync.Cond
+	sleeping atomic.Int64
+	// set under mu once the run is over; late async results are dropped
+	over bool
+}
+
+// returns bindings, boolean=true if deadlock detected and the run's statistics
+func (i *Interpreter) interpretWorkStealing(initial []process) (bindings, bool, Stats) {
+	n := i.numWorkers
+	if n < 1 {
+		n = 1
+	}
+	i.stats.begin()
+	s := &stealScheduler{i: i, deques: make([]*deque, n)}
+	s.wakeup = sync.NewCond(&s.idle)
+	for w := range s.deques {
+		s.deques[w] = &deque{}
+	}
+	i.beginRun(stealAsync{s})
+	defer i.endRun()
+	for k, p := range initial {
+		s.push(k%n, i.spawn(p))
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			s.work(w)
+		}(w)
+	}
+	// sleeping workers have to notice an interrupt
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-i.halt:
+			s.idle.Lock()
+			s.wakeup.Broadcast()
+			s.idle.Unlock()
+		case <-stop:
+		}
+	}()
+	wg.Wait()
+	close(stop)
+	s.mu.Lock()
+	s.over = true
+	s.mu.Unlock()
+	if i.numSuspended > 0 && !i.interrupted() {
+		i.stuck = i.suspendedProcesses()
+		return nil, true, i.stats.end()
+	}
+	return i.bindings, false, i.stats.end()
+}
+
+func (s *stealScheduler) push(w int, p process) {
+	s.active.Add(1)
+	s.i.stats.poolDelta(1)
+	s.deques[w].pushBottom(p)
+	if s.sleeping.Load() > 0 {
+		s.idle.Lock()
+		s.wakeup.Signal()
+		s.idle.Unlock()
+	}
+}
+
+// done is called once a process, or an async call, is no longer active
+func (s *stealScheduler) done() {
+	if s.active.Add(-1) > 0 {
+		return
+	}
+	// idle workers have to notice we are done
+	s.idle.Lock()
+	s.wakeup.Broadcast()
+	s.idle.Unlock()
+}
+
+// sleep waits until there may be something to do
+func (s *stealScheduler) sleep() {
+	s.idle.Lock()
+	defer s.idle.Unlock()
+	s.sleeping.Add(1)
+	defer s.sleeping.Add(-1)
+	// push checks for sleepers after pushing, so whatever it
+	// pushed before we started sleeping is seen here
+	for s.active.Load() > 0 && s.empty() && !s.i.interrupted() {
+		s.wakeup.Wait()
+	}
+}
+
+func (s *stealScheduler) empty() bool {
+	for _, d := range s.deques {
+		d.Lock()
+		n := len(d.items)
+		d.Unlock()
+		if n > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *stealScheduler) work(w int) {
+	for !s.i.interrupted() {
+		p, ok := s.deques[w].popBottom()
+		if !ok {
+			p, ok = s.steal(w)
+		}
+		if !ok {
+			if s.active.Load() == 0 {
+				if s.closePorts(w) {
+					continue
+				}
+				return
+			}
+			// others are busy, or async calls are outstanding
+			s.sleep()
+			continue
+		}
+		s.i.stats.poolDelta(-1)
+		s.run(w, p)
+		// anything spawned by p has been pushed already,
+		// so this can only reach zero if there is truly nothing left
+		s.done()
+	}
+}
+
+func (s *stealScheduler) steal(w int) (process, bool) {
+	n := len(s.deques)
+	for k := 1; k < n; k++ {
+		if p, ok := s.deques[(w+k)%n].popTop(); ok {
+			return p, true
+		}
+	}
+	return process{}, false
+}
+
+func (s *stealScheduler) run(w int, p process) {
+	i := s.i
+	if p.isPredefined() {
+		// builtins are cheap; run them under the write lock directly
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		ok, theta, r, suspendOn, a := i.execute(i.bindings, p)
+		a.worker = w + 1
+		if !ok {
+			s.suspend(w, a, p, suspendOn)
+			return
+		}
+		s.commit(w, a, p, r, theta)
+		return
+	}
+	s.mu.RLock()
+	ok, theta, r1, suspendOn, a := i.reduceProcess(w+1, i.bindings, p)
+	s.mu.RUnlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !ok {
+		s.suspend(w, a, p, suspendOn)
+		return
+	}
+	s.commit(w, a, p, r1, theta)
+}
+
+// closePorts closes the ports nobody can send to anymore, and returns
+// whether there is anything left to do
+func (s *stealScheduler) closePorts(w int) bool {
+	i := s.i
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.active.Load() == 0 {
+		by, theta := i.closePorts(i.suspendedProcesses())
+		if len(theta) == 0 {
+			return false
+		}
+		for _, q := range i.bind(w+1, by, i.bindings, theta) {
+			s.push(w, q)
+		}
+	}
+	return true
+}
+
+// only call while holding the write lock
+// a is the attempt that suspended p
+func (s *stealScheduler) suspend(w int, a attempt, p process, suspendOn []variable) {
+	i := s.i
+	if len(suspendOn) == 0 {
+		// if no suspensions, this process is guaranteed to never succeed
+		i.outcome(a, p, rule{}, false, nil)
+		i.failed = append(i.failed, stuckProcess{p: p})
+		return
+	}
+	// another worker might have bound one of these since we read the bindings;
+	// if so, suspending would mean waiting forever, so try again instead
+	for _, v := range suspendOn {
+		if _, bound := i.bindings[v]; bound {
+			s.push(w, p)
+			return
+		}
+	}
+	i.outcome(a, p, rule{}, false, suspendOn)
+	if by, theta := i.demand(suspendOn); len(theta) > 0 {
+		// p was waiting for more input: read it and try again
+		for _, q := range i.bind(w+1, by, i.bindings, theta) {
+			s.push(w, q)
+		}
+		s.push(w, p)
+		return
+	}
+	i.suspend(p, suspendOn)
+}
+
+// only call while holding the write lock
+// r is the rule that reduced p in attempt a, empty for builtins
+func (s *stealScheduler) commit(w int, a attempt, p process, r rule, theta bindings) {
+	i := s.i
+	for k := range theta {
+		if _, ok := i.bindings[k]; ok {
+			// single-assignment means if we find a clash, we return the work
+			i.stats.rejected.Add(1)
+			s.push(w, p)
+			return
+		}
+	}
+	i.outcome(a, p, r, true, nil)
+	for _, q := range i.bind(w+1, p, i.bindings, theta) {
+		s.push(w, q)
+	}
+	for _, q := range r.body {
+		s.push(w, i.spawn(spawnedBy(q, p, r)))
+	}
+}
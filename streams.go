@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+/*
+Lazy input streams: read_lines(File, S) and read_chars(File, S) read the
+first element only, and remember that the variable in the tail of S is the
+end of a lazy stream. Whenever a process suspends on such a variable, the
+scheduler calls demand, which reads one more element like an async call
+would (see async.go) and binds the variable to [Elem|S1], S1 being the new
+end of the stream, or to [] at the end of the input, waking the process.
+So a file is read exactly as far as its consumers have got, however many
+workers there are, and a slow read holds up nobody else.
+Lazy variables are guarded by the same lock as the bindings.
+
+write_lines(File, S) is the other direction: it writes every element of S
+as a line of its own, as they arrive, and closes the file at the end of S.
+File is a string, or stdin and stdout for the standard streams.
+Files still open when the run ends are closed then.
+*/
+
+type lazyStream struct {
+	// the process that opened the stream, as far as bindings are concerned
+	by   process
+	next func() (expression, bool)
+	in   io.Closer
+}
+
+// SetInput sets what reading from stdin reads from; the default is os.Stdin
+func (i *Interpreter) SetInput(r io.Reader) {
+	i.in = bufio.NewReader(r)
+}
+
+// openStream makes s, an unbound variable, the start of a lazy stream
+// of lines or characters read from file
+func (i *Interpreter) openStream(by process, file expression, s variable, lines bool) error {
+	var r *bufio.Reader
+	var c io.Closer
+	// stdin may be read by several streams at a time
+	mu := &sync.Mutex{}
+	switch t := file.(type) {
+	case atom:
+		if t != "stdin" {
+			return fmt.Errorf("cannot read from %s", t)
+		}
+		r, mu = i.in, &i.inMu
+	case str:
+		f, err := os.Open(string(t))
+		if err != nil {
+			return err
+		}
+		r, c = bufio.NewReader(f), f
+	default:
+		return fmt.Errorf("cannot read from %s", t.PrintExpression())
+	}
+	next := func() (expression, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		// a read error ends the stream just like the end of the input does
+		c, _, err := r.ReadRune()
+		if err != nil {
+			return nil, false
+		}
+		return number(c), true
+	}
+	if lines {
+		next = func() (expression, bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			line, err := r.ReadString('\n')
+			if len(line) == 0 && err != nil {
+				return nil, false
+			}
+			return str(strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")), true
+		}
+	}
+	if i.lazy == nil {
+		i.lazy = map[variable]*lazyStream{}
+	}
+	i.lazy[s] = &lazyStream{by: by, next: next, in: c}
+	return nil
+}
+
+// demand reads the next element of each lazy stream ending in one of vars.
+// The scheduler's async host takes care of the read and of binding the result,
+// so demand returns nothing; without a host, as in the debugger, it reads
+// right away and returns the bindings that extend the streams and who made them
+func (i *Interpreter) demand(vars []variable) (process, bindings) {
+	var by process
+	var theta bindings
+	for _, v := range vars {
+		s, ok := i.lazy[v]
+		if !ok {
+			continue
+		}
+		// until this read is done, nobody else has to ask
+		delete(i.lazy, v)
+		if host := i.async; host != nil {
+			host.started()
+			go func() {
+				x, ok := s.read()
+				host.finished(asyncResult{p: s.by, outputs: func(i *Interpreter) (bindings, bool) {
+					if _, bound := i.bindings[v]; bound {
+						i.errs[s.by.id] = fmt.Errorf("stream %s was bound by someone else", v.PrintExpression())
+						return nil, false
+					}
+					return bindings{v: i.extend(s, x, ok)}, true
+				}})
+			}()
+			continue
+		}
+		if theta == nil {
+			theta = bindings{}
+		}
+		by = s.by
+		x, ok := s.read()
+		theta[v] = i.extend(s, x, ok)
+	}
+	return by, theta
+}
+
+// read returns the next element of s, if any; at the end the input is closed
+func (s *lazyStream) read() (expression, bool) {
+	x, ok := s.next()
+	if !ok && s.in != nil {
+		s.in.Close()
+	}
+	return x, ok
+}
+
+// extend returns what the end of s is bound to after reading x, and makes
+// the new end lazy; only call while holding the write lock
+func (i *Interpreter) extend(s *lazyStream, x expression, ok bool) expression {
+	if !ok {
+		return emptylist
+	}
+	tail := i.fresh()
+	i.lazy[tail] = s
+	return list{head: x, tail: tail}
+}
+
+// closeFiles closes the files of streams that were not read or written to
+// the end; only call once the run is over
+func (i *Interpreter) closeFiles() {
+	for _, s := range i.lazy {
+		if s.in != nil {
+			s.in.Close()
+		}
+	}
+	i.lazy = nil
+	for _, f := range i.outputs {
+		f.Close()
+	}
+	i.outputs = nil
+}
+
+// writeLines writes the elements of s available in b to file, one per line,
+// and returns the rest of s; at the end of s the file is closed.
+// An element is only available once it is fully bound
+func (i *Interpreter) writeLines(b bindings, file, s expression) (expression, error) {
+	var w io.Writer
+	switch t := file.(type) {
+	case atom:
+		if t != "stdout" {
+			return nil, fmt.Errorf("cannot write to %s", t)
+		}
+	case str:
+		f, ok := i.outputs[t]
+		if !ok {
+			var err error
+			f, err = os.Create(string(t))
+			if err != nil {
+				return nil, err
+			}
+			if i.outputs == nil {
+				i.outputs = map[str]*os.File{}
+			}
+			i.outputs[t] = f
+		}
+		w = f
+	default:
+		return nil, fmt.Errorf("cannot write to %s", t.PrintExpression())
+	}
+	var sb strings.Builder
+	s = walk(b, s)
+	for {
+		l, ok := s.(list)
+		if !ok {
+			break
+		}
+		head := walkDeep(b, l.head)
+		if len(unboundIn(head, nil)) > 0 {
+			break
+		}
+		sb.WriteString(display(b, head))
+		sb.WriteString("\n")
+		s = walk(b, l.tail)
+	}
+	if w == nil {
+		i.write(sb.String())
+	} else if _, err := io.WriteString(w, sb.String()); err != nil {
+		return nil, err
+	}
+	if s == emptylist {
+		if f, ok := w.(*os.File); ok {
+			delete(i.outputs, file.(str))
+			return s, f.Close()
+		}
+	}
+	return s, nil
+}
+
+// display prints e as write does: strings without quotes
+func display(b bindings, e expression) string {
+	e = walkDeep(b, e)
+	if s, ok := e.(str); ok {
+		return string(s)
+	}
+	return e.PrintExpression()
+}
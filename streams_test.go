@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadWriteLines(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.txt")
+	if err := os.WriteFile(in, []byte("alpha\nbeta\ngamma"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := MustParseRules(`
+    number([X|Xs], K, Out, N) :- Out := [[K,X]|Out1], isplus(K1, K, 1), number(Xs, K1, Out1, N).
+    number([], K, Out, N) :- Out := [], N := K.`)
+	for name, interpret := range schedulers {
+		for _, e := range engines {
+			out := filepath.Join(dir, name+".txt")
+			i := NewInterpreter(s, 4)
+			i.engine = e
+			q, b := i.MustParseProcesses(`read_lines("` + in + `", L), number(L, 1, Out, N), write_lines("` + out + `", Out)`)
+			res, deadlocked, _ := interpret(i, q)
+			if deadlocked {
+				t.Fatalf("%s, engine %d: deadlocked!\n%s", name, e, i.Report())
+			}
+			if got := walk(res, b["N"]); got != number(4) {
+				t.Errorf("%s, engine %d: expected 4 but got %s", name, e, got.PrintExpression())
+			}
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "[1|[\"alpha\"]]\n[2|[\"beta\"]]\n[3|[\"gamma\"]]\n"
+			if string(data) != want {
+				t.Errorf("%s, engine %d: wrote %q, want %q", name, e, data, want)
+			}
+		}
+	}
+}
+
+func TestReadLazily(t *testing.T) {
+	s := MustParseRules(`
+    take([_|N], [X|Xs], Out) :- Out := [X|Out1], take(N, Xs, Out1).
+    take([], _, Out) :- Out := [].`)
+	for _, e := range engines {
+		i := NewSingleThreadedInterpreter(s)
+		i.engine = e
+		i.SetInput(strings.NewReader("ab"))
+		q, b := i.MustParseProcesses("read_chars(stdin, S), take([one], S, Out)")
+		res, deadlocked, _ := i.interpretSinglethreaded(q)
+		if deadlocked {
+			t.Fatalf("engine %d: deadlocked!", e)
+		}
+		if got := walkDeep(res, b["Out"]).PrintExpression(); got != "[97]" {
+			t.Errorf("engine %d: expected [97] but got %s", e, got)
+		}
+		// nobody asked for the second character
+		l, ok := walk(res, b["S"]).(list)
+		if !ok {
+			t.Fatalf("engine %d: expected a stream but got %s", e, walkDeep(res, b["S"]).PrintExpression())
+		}
+		if _, ok := walk(res, l.tail).(variable); !ok {
+			t.Errorf("engine %d: expected only one character read but got %s", e, walkDeep(res, b["S"]).PrintExpression())
+		}
+	}
+}
+
+func TestReadMissingFile(t *testing.T) {
+	i := NewSingleThreadedInterpreter(nil)
+	q, _ := i.MustParseProcesses(`read_lines("/does/not/exist", S)`)
+	i.interpretSinglethreaded(q)
+	if got := i.Report(); !strings.HasPrefix(got, `failed: #1 read_lines("/does/not/exist",v#0): open /does/not/exist:`) {
+		t.Errorf("expected the error in the report but got\n%s", got)
+	}
+}
+
+func TestFilesClosedAtEnd(t *testing.T) {
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "in.txt"), filepath.Join(dir, "out.txt")
+	if err := os.WriteFile(in, []byte("alpha\nbeta\ngamma"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := MustParseRules(`
+    take([_|N], [X|Xs], Out) :- Out := [X|Out1], take(N, Xs, Out1).
+    take([], _, Out) :- Out := [].`)
+	i := NewSingleThreadedInterpreter(s)
+	// neither stream is finished: only one line is read, and W never ends
+	q, _ := i.MustParseProcesses(`read_lines("` + in + `", S), take([one], S, Out), write_lines("` + out + `", W), W := ["a"|T]`)
+	if _, deadlocked, _ := i.interpretSinglethreaded(q); !deadlocked {
+		t.Fatalf("expected write_lines to be left waiting but got\n%s", i.Report())
+	}
+	if len(i.lazy) != 0 || len(i.outputs) != 0 {
+		t.Errorf("expected all files closed but %d inputs and %d outputs are left", len(i.lazy), len(i.outputs))
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a\n" {
+		t.Errorf("wrote %q, want %q", data, "a\n")
+	}
+}
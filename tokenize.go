@@ -30,11 +30,15 @@ func (t token) IsNumber() bool {
 }
 
 func (t token) IsVariable() bool {
-	return unicode.IsUpper(rune(t[0]))
+	return len(t) > 0 && unicode.IsUpper(rune(t[0]))
 }
 
 func (t token) IsSymbol() bool {
-	return unicode.IsLower(rune(t[0]))
+	return len(t) > 0 && unicode.IsLower(rune(t[0]))
+}
+
+func (t token) IsString() bool {
+	return len(t) > 0 && t[0] == '"'
 }
 
 func (t token) IsOperator() bool {
@@ -49,6 +53,20 @@ func tokenize(s string) []token {
 	out := []token{}
 	s = strings.TrimSpace(s)
 	for len(s) > 0 {
+		if s[0] == '"' {
+			// a string runs up to the next unescaped quote
+			i := 1
+			for i < len(s) && s[i] != '"' {
+				if s[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i = min(i+1, len(s))
+			out = append(out, token(s[:i]))
+			s = strings.TrimSpace(s[i:])
+			continue
+		}
 		var punct token
 		switch s[:1] {
 		case "(":
@@ -105,6 +123,9 @@ func tokenize(s string) []token {
 			}
 		}
 		i := strings.IndexAny(s, "\t\n (),|].")
+		if i < 0 {
+			i = len(s)
+		}
 		out = append(out, token(s[:i]))
 		s = s[i:]
 		s = strings.TrimSpace(s)
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+type EventKind uint8
+
+const (
+	// a process was put into the pool
+	EventSpawn EventKind = iota
+	// a process was reduced by a rule, or a builtin succeeded
+	EventReduce
+	// a process suspended on Vars
+	EventSuspend
+	// a suspended process was woken by binding Var
+	EventWakeup
+	// Var was bound to Value by Process
+	EventBind
+	// a process can never succeed and is dropped
+	EventFail
+)
+
+var eventNames = map[EventKind]string{
+	EventSpawn:   "spawn",
+	EventReduce:  "reduce",
+	EventSuspend: "suspend",
+	EventWakeup:  "wakeup",
+	EventBind:    "bind",
+	EventFail:    "fail",
+}
+
+func (k EventKind) String() string {
+	return eventNames[k]
+}
+
+// not every field is set for every kind of event
+type Event struct {
+	// order in which events were emitted, starting at 1
+	Seq     uint64
+	Time    time.Time
+	Kind    EventKind
+	Process process
+	// for spawns: id of the process whose reduction spawned Process, 0 for the goal
+	Parent uint64
+	// the rule that reduced Process, empty for builtins;
+	// for spawns the rule whose body Process came from
+	Rule  rule
+	Vars  []variable
+	Var   variable
+	Value expression
+	// routine that did the work: 0 is the main interpreter routine,
+	// workers are numbered from 1
+	Worker int
+	// for reductions and builtins: Time is when the attempt started,
+	// Duration how long it took
+	Duration time.Duration
+}
+
+func (e Event) String() string {
+	switch e.Kind {
+	case EventReduce:
+		if len(e.Rule.head.functor) == 0 {
+			return fmt.Sprintf("%d reduce #%d %s", e.Seq, e.Process.id, e.Process)
+		}
+		return fmt.Sprintf("%d reduce #%d %s by %s", e.Seq, e.Process.id, e.Process, e.Rule)
+	case EventSuspend:
+		return fmt.Sprintf("%d suspend #%d %s on %s", e.Seq, e.Process.id, e.Process, printVars(e.Vars))
+	case EventWakeup:
+		return fmt.Sprintf("%d wakeup #%d %s by %s", e.Seq, e.Process.id, e.Process, e.Var.PrintExpression())
+	case EventSpawn:
+		if e.Parent == 0 {
+			return fmt.Sprintf("%d spawn #%d %s", e.Seq, e.Process.id, e.Process)
+		}
+		return fmt.Sprintf("%d spawn #%d %s from #%d", e.Seq, e.Process.id, e.Process, e.Parent)
+	case EventBind:
+		return fmt.Sprintf("%d bind %s = %s", e.Seq, e.Var.PrintExpression(), e.Value.PrintExpression())
+	}
+	return fmt.Sprintf("%d %s #%d %s", e.Seq, e.Kind, e.Process.id, e.Process)
+}
+
+func printVars(vars []variable) string {
+	s := []string{}
+	for _, v := range vars {
+		s = append(s, v.PrintExpression())
+	}
+	return strings.Join(s, ",")
+}
+
+// Tracer receives events from all interpreter routines,
+// so implementations have to be safe for concurrent use
+type Tracer interface {
+	Trace(Event)
+}
+
+func (i *Interpreter) SetTracer(t Tracer) {
+	i.tracer = t
+}
+
+func (i *Interpreter) trace(e Event) {
+	if i.tracer == nil {
+		return
+	}
+	e.Seq = i.traceSeq.Add(1)
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	i.tracer.Trace(e)
+}
+
+// attempt is how a reduction or builtin execution came about. What it
+// amounted to is only reported once a scheduler acts on it, see outcome,
+// since a worker's result can still be rejected because of a binding clash
+type attempt struct {
+	builtin bool
+	// see Event; start and duration are only set when tracing
+	worker   int
+	start    time.Time
+	duration time.Duration
+}
+
+// outcome reports what became of attempt a for p: committed by r, suspended
+// on suspendOn or failed. Schedulers call it where they commit, suspend or
+// drop p, so every consumer sees the same, actual run
+func (i *Interpreter) outcome(a attempt, p process, r rule, ok bool, suspendOn []variable) {
+	i.recordOutcome(p, r, ok, suspendOn)
+	i.report(a, p, r, ok, suspendOn)
+}
+
+// report is outcome for attempts that leave nothing for a replay to repeat
+func (i *Interpreter) report(a attempt, p process, r rule, ok bool, suspendOn []variable) {
+	i.stats.outcome(a.builtin, ok, suspendOn)
+	if ok && !a.builtin && i.profiler != nil {
+		i.profiler.commit(r)
+	}
+	if i.tracer != nil {
+		e := outcomeEvent(p, r, ok, suspendOn)
+		e.Worker, e.Time, e.Duration = a.worker, a.start, a.duration
+		i.trace(e)
+	}
+}
+
+func outcomeEvent(p process, r rule, ok bool, suspendOn []variable) Event {
+	switch {
+	case ok:
+		return Event{Kind: EventReduce, Process: p, Rule: r}
+	case len(suspendOn) > 0:
+		return Event{Kind: EventSuspend, Process: p, Vars: suspendOn}
+	}
+	return Event{Kind: EventFail, Process: p}
+}
+
+type multiTracer []Tracer
+
+// MultiTracer passes every event on to all of ts
+func MultiTracer(ts ...Tracer) Tracer {
+	return multiTracer(ts)
+}
+
+func (m multiTracer) Trace(e Event) {
+	for _, t := range m {
+		t.Trace(e)
+	}
+}
+
+type textTracer struct {
+	sync.Mutex
+	w io.Writer
+}
+
+// NewTextTracer writes one human-readable line per event
+func NewTextTracer(w io.Writer) Tracer {
+	return &textTracer{w: w}
+}
+
+func (t *textTracer) Trace(e Event) {
+	t.Lock()
+	defer t.Unlock()
+	fmt.Fprintln(t.w, e)
+}
+
+type jsonTracer struct {
+	sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONTracer writes one JSON object per event per line
+func NewJSONTracer(w io.Writer) Tracer {
+	return &jsonTracer{enc: json.NewEncoder(w)}
+}
+
+type jsonEvent struct {
+	Seq     uint64   `json:"seq"`
+	Time    int64    `json:"time"`
+	Kind    string   `json:"kind"`
+	ID      uint64   `json:"id,omitempty"`
+	Process string   `json:"process,omitempty"`
+	Parent  uint64   `json:"parent,omitempty"`
+	Rule    string   `json:"rule,omitempty"`
+	Vars    []string `json:"vars,omitempty"`
+	Var     string   `json:"var,omitempty"`
+	Value   string   `json:"value,omitempty"`
+	Worker  int      `json:"worker,omitempty"`
+	// in nanoseconds
+	Duration int64 `json:"duration,omitempty"`
+}
+
+func toJSONEvent(e Event) jsonEvent {
+	je := jsonEvent{
+		Seq:  e.Seq,
+		Time: e.Time.UnixNano(),
+		Kind: e.Kind.String(),
+	}
+	if len(e.Process.functor) > 0 {
+		je.ID = e.Process.id
+		je.Process = e.Process.String()
+	}
+	je.Parent = e.Parent
+	if len(e.Rule.head.functor) > 0 {
+		je.Rule = e.Rule.String()
+	}
+	for _, v := range e.Vars {
+		je.Vars = append(je.Vars, v.PrintExpression())
+	}
+	if e.Kind == EventBind || e.Kind == EventWakeup {
+		je.Var = e.Var.PrintExpression()
+	}
+	if e.Value != nil {
+		je.Value = e.Value.PrintExpression()
+	}
+	je.Worker = e.Worker
+	je.Duration = int64(e.Duration)
+	return je
+}
+
+func (t *jsonTracer) Trace(e Event) {
+	t.Lock()
+	defer t.Unlock()
+	t.enc.Encode(toJSONEvent(e))
+}
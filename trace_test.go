@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+type recordingTracer struct {
+	sync.Mutex
+	events []Event
+}
+
+func (t *recordingTracer) Trace(e Event) {
+	t.Lock()
+	defer t.Unlock()
+	t.events = append(t.events, e)
+}
+
+func (t *recordingTracer) count(kind EventKind) int {
+	n := 0
+	for _, e := range t.events {
+		if e.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+func TestTraceSingleThreaded(t *testing.T) {
+	for _, e := range engines {
+		i := NewSingleThreadedInterpreter(templateProgram)
+		i.engine = e
+		rec := &recordingTracer{}
+		i.SetTracer(rec)
+		q, b := i.MustParseProcesses("sum([1,2,3],R)")
+		res, deadlocked, _ := i.interpretSinglethreaded(q)
+		if deadlocked {
+			t.Fatalf("engine %d: deadlocked!", e)
+		}
+		// sum, sum1 four times, isplus three times and :=
+		if got := rec.count(EventSpawn); got != 9 {
+			t.Errorf("engine %d: expected 9 spawns but got %d", e, got)
+		}
+		if got := rec.count(EventReduce); got != 9 {
+			t.Errorf("engine %d: expected 9 reductions but got %d", e, got)
+		}
+		found := false
+		for _, ev := range rec.events {
+			if ev.Kind == EventBind && ev.Var == b["R"] && walk(res, ev.Value) == number(6) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("engine %d: expected R to be bound to 6", e)
+		}
+		for n, ev := range rec.events {
+			if ev.Seq != uint64(n+1) {
+				t.Fatalf("engine %d: expected sequence number %d but got %d", e, n+1, ev.Seq)
+			}
+		}
+	}
+}
+
+func TestTraceSuspendAndWakeup(t *testing.T) {
+	i := NewSingleThreadedInterpreter(templateProgram)
+	rec := &recordingTracer{}
+	i.SetTracer(rec)
+	q, b := i.MustParseProcesses("sum(L,R)")
+	if _, deadlocked, _ := i.interpretSinglethreaded(q); !deadlocked {
+		t.Fatalf("expected deadlock")
+	}
+	if rec.count(EventSuspend) != 1 {
+		t.Fatalf("expected a suspension but got %v", rec.events)
+	}
+	woken := i.bind(0, process{}, i.bindings, bindings{b["L"]: emptylist})
+	if len(woken) != 1 || rec.count(EventWakeup) != 1 {
+		t.Errorf("expected a wakeup but got %v", rec.events)
+	}
+}
+
+func TestTraceRejectedResult(t *testing.T) {
+	i := NewInterpreter(templateProgram, 1)
+	rec := &recordingTracer{}
+	i.SetTracer(rec)
+	q, b := i.MustParseProcesses("X := 1")
+	res := result{b: bindings{b["X"]: number(1)}, p: q[0], success: true, attempt: attempt{builtin: true}}
+	// another result bound X first: this one never happened
+	i.handleResult(bindings{b["X"]: number(2)}, res)
+	if got := rec.count(EventReduce); got != 0 {
+		t.Errorf("expected no reductions for a rejected result but got %v", rec.events)
+	}
+	if s := i.Stats(); s.BuiltinExecutions != 0 || s.RejectedResults != 1 {
+		t.Errorf("expected only a rejected result but got %+v", s)
+	}
+	i.handleResult(bindings{}, res)
+	if got := rec.count(EventReduce); got != 1 {
+		t.Errorf("expected a reduction once committed but got %v", rec.events)
+	}
+}
+
+func TestJSONTracer(t *testing.T) {
+	var buf bytes.Buffer
+	i := NewSingleThreadedInterpreter(templateProgram)
+	i.SetTracer(NewJSONTracer(&buf))
+	q, _ := i.MustParseProcesses("sum([1,2],R)")
+	i.interpretSinglethreaded(q)
+	scanner := bufio.NewScanner(&buf)
+	lines := 0
+	for scanner.Scan() {
+		var je jsonEvent
+		if err := json.Unmarshal(scanner.Bytes(), &je); err != nil {
+			t.Fatalf("%d: %v", lines, err)
+		}
+		if je.Kind == "" || je.Seq == 0 {
+			t.Errorf("%d: incomplete event %s", lines, scanner.Text())
+		}
+		lines++
+	}
+	if lines == 0 {
+		t.Fatalf("expected events")
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+)
+
+/*
+Transpiler from a Strand program plus goal to a standalone Go program.
+Each procedure is compiled first (see compile.go), after which every clause
+becomes a Go function executing its instructions natively with registers
+as local variables. The generated program embeds a small runtime for
+variables, suspension and scheduling; like interpretSinglethreaded it runs
+one process at a time and prints the query variables at the end.
+*/
+
+//go:embed transpile_runtime.go.tmpl
+var transpileRuntime string
+
+var transpiledBuiltins = map[procKey]string{
+	{":=", 2}:           "builtinAssign",
+	{"isplus", 3}:       "builtinIsplus",
+	{"write", 1}:        "builtinWrite",
+	{"writeln", 1}:      "builtinWriteln",
+	{"nl", 0}:           "builtinNl",
+	{"print_stream", 1}: "builtinPrintStream",
+}
+
+func init() {
+	for n := 0; n <= maxCallArgs; n++ {
+		transpiledBuiltins[procKey{"call", n + 1}] = "builtinCall"
+	}
+}
+
+func transpile(program []rule, goal []process, names map[string]variable) ([]byte, error) {
+	code := compileProgram(program)
+	keys := []procKey{}
+	for k := range code {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if keys[a].functor != keys[b].functor {
+			return keys[a].functor < keys[b].functor
+		}
+		return keys[a].arity < keys[b].arity
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by strandbeest build. DO NOT EDIT.\n\n")
+	buf.WriteString("package main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n\t\"strings\"\n)\n\n")
+	buf.WriteString(transpileRuntime)
+	for _, k := range keys {
+		if err := transpileProcedure(&buf, code, k); err != nil {
+			return nil, err
+		}
+	}
+	transpileProcs(&buf, code, keys)
+	if err := transpileMain(&buf, code, goal, names); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// procName mangles functor/arity into a Go identifier
+func procName(k procKey) string {
+	var sb strings.Builder
+	sb.WriteString("p_")
+	for _, r := range k.functor {
+		if r < 128 && (r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			sb.WriteRune(r)
+			continue
+		}
+		fmt.Fprintf(&sb, "x%x", r)
+	}
+	fmt.Fprintf(&sb, "_%d", k.arity)
+	return sb.String()
+}
+
+func procRef(code compiledProgram, k procKey) (string, error) {
+	if name, ok := transpiledBuiltins[k]; ok {
+		return name, nil
+	}
+	if _, ok := code[k]; ok {
+		return procName(k), nil
+	}
+	return "", fmt.Errorf("unknown procedure %s/%d", k.functor, k.arity)
+}
+
+// transpileProcs writes the table call looks goals up in; it is filled in
+// by init, as builtinCall refers to it
+func transpileProcs(buf *bytes.Buffer, code compiledProgram, keys []procKey) {
+	refs := map[string]string{}
+	for k, name := range transpiledBuiltins {
+		refs[fmt.Sprintf("%s/%d", k.functor, k.arity)] = name
+	}
+	for _, k := range keys {
+		refs[fmt.Sprintf("%s/%d", k.functor, k.arity)] = procName(k)
+	}
+	names := []string{}
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf.WriteString("var procs map[string]Proc\n\nfunc init() {\nprocs = map[string]Proc{\n")
+	for _, name := range names {
+		fmt.Fprintf(buf, "%q: %s,\n", name, refs[name])
+	}
+	buf.WriteString("}\n}\n\n")
+}
+
+func transpileProcedure(buf *bytes.Buffer, code compiledProgram, k procKey) error {
+	proc := code[k]
+	name := procName(k)
+	clauses := []string{}
+	for n, c := range proc.clauses {
+		cname := fmt.Sprintf("%s_%d", name, n)
+		clauses = append(clauses, cname)
+		fmt.Fprintf(buf, "// %s\nfunc %s(rt *Runtime, a []Term) (bool, *Var) {\n", c.rule, cname)
+		if c.nregs > 0 {
+			regs := []string{}
+			for r := 0; r < c.nregs; r++ {
+				regs = append(regs, fmt.Sprintf("r%d", r))
+			}
+			fmt.Fprintf(buf, "var %s Term\n", strings.Join(regs, ", "))
+			for r := 0; r < k.arity; r++ {
+				fmt.Fprintf(buf, "r%d = a[%d]\n", r, r)
+			}
+			// not every register is read in every clause
+			fmt.Fprintf(buf, "%s = %s\n", strings.Repeat("_, ", c.nregs-1)+"_", strings.Join(regs, ", "))
+		}
+		for pc := c.entry; ; pc++ {
+			in := proc.code[pc]
+			if in.op == opProceed {
+				buf.WriteString("return true, nil\n}\n\n")
+				break
+			}
+			if err := transpileInstr(buf, code, in); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Fprintf(buf, "func %s(rt *Runtime, a []Term) (bool, []*Var) {\n", name)
+	buf.WriteString("var suspend []*Var\n")
+	fmt.Fprintf(buf, "for _, clause := range []func(*Runtime, []Term) (bool, *Var){%s} {\n", strings.Join(clauses, ", "))
+	buf.WriteString("ok, s := clause(rt, a)\nif ok {\nreturn true, nil\n}\nif s != nil {\nsuspend = append(suspend, s)\n}\n}\n")
+	buf.WriteString("return false, suspend\n}\n\n")
+	return nil
+}
+
+func transpileInstr(buf *bytes.Buffer, code compiledProgram, in instr) error {
+	switch in.op {
+	case opGetValue:
+		fmt.Fprintf(buf, "if ok, s := Equal(r%d, r%d); !ok {\nreturn false, s\n}\n", in.a, in.b)
+	case opGetConst:
+		k, err := goTerm(in.k, nil)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, "if ok, s := MatchConst(r%d, %s); !ok {\nreturn false, s\n}\n", in.a, k)
+	case opGetList:
+		fmt.Fprintf(buf, "if h, t, ok, s := MatchList(r%d); !ok {\nreturn false, s\n} else {\nr%d, r%d = h, t\n}\n", in.a, in.b, in.c)
+	case opGetStruct:
+		fmt.Fprintf(buf, "if args, ok, s := MatchStruct(r%d, %q); !ok {\nreturn false, s\n} else {\nr%d = args\n}\n", in.a, in.s, in.b)
+	case opGuard:
+		fmt.Fprintf(buf, "if ok, s := Guard(%q, r%d, r%d); !ok {\nreturn false, s\n}\n", in.s, in.a, in.b)
+	case opCommit:
+		buf.WriteString("// commit\n")
+	case opPutVar:
+		fmt.Fprintf(buf, "r%d = rt.NewVar()\n", in.a)
+	case opPutConst:
+		k, err := goTerm(in.k, nil)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, "r%d = %s\n", in.a, k)
+	case opPutList:
+		fmt.Fprintf(buf, "r%d = &Cons{r%d, r%d}\n", in.a, in.b, in.c)
+	case opPutStruct:
+		fmt.Fprintf(buf, "r%d = &Struct{%q, r%d}\n", in.a, in.s, in.b)
+	case opSpawn:
+		ref, err := procRef(code, procKey{in.s, len(in.regs)})
+		if err != nil {
+			return err
+		}
+		args := []string{ref}
+		for _, r := range in.regs {
+			args = append(args, fmt.Sprintf("r%d", r))
+		}
+		fmt.Fprintf(buf, "rt.Spawn(%s)\n", strings.Join(args, ", "))
+	default:
+		return fmt.Errorf("cannot transpile instruction %s", in)
+	}
+	return nil
+}
+
+// goTerm returns Go source constructing e; vars names the query variables
+func goTerm(e expression, vars map[variable]string) (string, error) {
+	switch t := e.(type) {
+	case number:
+		return fmt.Sprintf("Int(%d)", t), nil
+	case atom:
+		return fmt.Sprintf("Atom(%q)", string(t)), nil
+	case str:
+		return fmt.Sprintf("Str(%q)", string(t)), nil
+	case special:
+		switch t {
+		case emptylist:
+			return "Nil", nil
+		case underscore:
+			return "Underscore", nil
+		case true_value:
+			return "True", nil
+		case false_value:
+			return "False", nil
+		}
+	case variable:
+		if name, ok := vars[t]; ok {
+			return name, nil
+		}
+	case list:
+		h, err := goTerm(t.head, vars)
+		if err != nil {
+			return "", err
+		}
+		tl, err := goTerm(t.tail, vars)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("&Cons{%s, %s}", h, tl), nil
+	case compound:
+		args, err := goTerm(t.args, vars)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("&Struct{%q, %s}", t.functor, args), nil
+	}
+	return "", fmt.Errorf("cannot transpile term %s", e.PrintExpression())
+}
+
+func transpileMain(buf *bytes.Buffer, code compiledProgram, goal []process, names map[string]variable) error {
+	keys := []string{}
+	for k := range names {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool { return names[keys[a]] < names[keys[b]] })
+	vars := map[variable]string{}
+	buf.WriteString("func main() {\nrt := NewRuntime()\n")
+	for _, k := range keys {
+		vars[names[k]] = "v_" + k
+		fmt.Fprintf(buf, "v_%s := rt.NewVar()\n", k)
+	}
+	for _, p := range goal {
+		ref, err := procRef(code, procKey{p.functor, p.arity()})
+		if err != nil {
+			return err
+		}
+		args := []string{ref}
+		for _, arg := range p.args {
+			t, err := goTerm(arg, vars)
+			if err != nil {
+				return err
+			}
+			args = append(args, t)
+		}
+		fmt.Fprintf(buf, "rt.Spawn(%s)\n", strings.Join(args, ", "))
+	}
+	buf.WriteString("if !rt.Run() {\nfmt.Fprintln(os.Stderr, \"deadlock\")\nos.Exit(1)\n}\n")
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(buf, "fmt.Printf(\"%s = %%s\\n\", Print(v_%s))\n", k, k)
+	}
+	buf.WriteString("}\n")
+	return nil
+}
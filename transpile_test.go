@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestTranspile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds generated programs")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not found")
+	}
+	member := `
+    member(X,[X1|Rest],R) :-
+        X =\= X1 | member(X,Rest,R).
+    member(X,[X1|_],R) :-
+        X == X1 | R := true.
+    member(_, [], R) :- R := false.`
+	higher := `
+    map(F, [X|Xs], Ys) :- call(F, X, Y), Ys := [Y|Ys1], map(F, Xs, Ys1).
+    map(F, [], Ys) :- Ys := [].
+    add(N, X, Y) :- isplus(Y, N, X).
+    apply(add(N), X, Y) :- isplus(Y, N, X).
+    apply(double, X, Y) :- isplus(Y, X, X).`
+	io := `
+    partial(X) :- writeln(X), X := [1|T], later(T).
+    pairs(S) :- S := [[A]|S1], print_stream(S), later(A, S1).
+    later(T) :- T := [2].
+    later(A, S) :- A := 1, S := [].`
+	for n, tt := range []struct {
+		program string
+		goal    string
+		// printed by the program before its results
+		out string
+	}{
+		{
+			program: `
+    sum(L, Sum) :- sum1(L, 0, Sum).
+    sum1([X|Xs], A, Sum) :-
+        isplus(A1, A, X),
+        sum1(Xs, A1, Sum).
+    sum1([], A, Sum) :-
+        Sum := A.`,
+			goal: "sum([1|L],R), L := [2,3]",
+		},
+		{program: member, goal: "member(2, [1,2,3], R)"},
+		{program: member, goal: "member(4, [1,2,3], R)"},
+		// lists built apart are still equal
+		{program: member, goal: "member([2,3], [[1],[2,3]], R)"},
+		{program: member, goal: "member([2,X], [[1],[2,3]], R), X := 3"},
+		// goals as data, matched in heads and run by call
+		{program: higher, goal: "map(add(10), [1,2,3], R)"},
+		{program: higher, goal: "map(apply(add(2)), [1,2], R)"},
+		{program: higher, goal: "map(apply(double), [1,2], R)"},
+		{program: higher, goal: "call(G, 1, R), G := add(5)"},
+		{program: higher, goal: "R := add(X, [3]), X := 1"},
+		// nothing is printed before it is fully bound
+		{program: io, goal: "partial(X)", out: "[1|[2]]\n"},
+		{program: io, goal: "pairs(S)", out: "[1]\n"},
+	} {
+		s := MustParseRules(tt.program)
+		i := NewSingleThreadedInterpreter(s)
+		q, names := i.MustParseProcesses(tt.goal)
+		res, deadlocked, _ := i.interpretSinglethreaded(q)
+		if deadlocked {
+			t.Fatalf("%d: deadlocked!", n)
+		}
+		want := tt.out + formatResults(names, res)
+
+		src, err := transpile(s, q, names)
+		if err != nil {
+			t.Fatalf("%d: %v", n, err)
+		}
+		dir := t.TempDir()
+		file := filepath.Join(dir, "prog.go")
+		if err := os.WriteFile(file, src, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		out, err := exec.Command(gobin, "run", file).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%d: %v\n%s", n, err, out)
+		}
+		if string(out) != want {
+			t.Errorf("%d: got %q want %q", n, out, want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
     "fmt"
+    "strconv"
     "strings"
 )
 
@@ -9,7 +10,8 @@ type bindings map[variable]expression
 
 // some notes:
 // for now, a process is not itself an expression
-// an expression is only ever a number, a var, or a list
+// an expression is only ever a number, an atom, a string, a var, a port, a list,
+// or a compound term
 type expression interface {
     PrintExpression() string
 }
@@ -26,6 +28,27 @@ func (n number) PrintExpression() string {
     return fmt.Sprintf("%d", n)
 }
 
+// a symbol used as data, like stdin
+type atom string
+
+func (a atom) PrintExpression() string {
+    return string(a)
+}
+
+// a quoted string, like "hello"
+type str string
+
+func (s str) PrintExpression() string {
+    return strconv.Quote(string(s))
+}
+
+// the sending end of a stream, see ports.go
+type port int64
+
+func (p port) PrintExpression() string {
+    return fmt.Sprintf("port#%d", p)
+}
+
 type special uint8
 
 const (
@@ -57,18 +80,39 @@ func (l list) PrintExpression() string {
     return fmt.Sprintf("[%s|%s]", l.head.PrintExpression(), l.tail.PrintExpression())
 }
 
+// a compound term like add(1), used as data: a goal for call, say.
+// args is a proper list rather than a slice, so that terms stay comparable
+type compound struct {
+    functor string
+    args expression
+}
+
+func (c compound) PrintExpression() string {
+    args := []string{}
+    for a := c.args; a != emptylist; a = a.(list).tail {
+        args = append(args, a.(list).head.PrintExpression())
+    }
+    return fmt.Sprintf("%s(%s)", c.functor, strings.Join(args, ","))
+}
+
 type process struct {
     functor string
     args []expression
+    // numbered in the order processes are spawned, starting at 1;
+    // 0 for processes that are not (yet) in a pool
+    id uint64
+    // nil for the goal
+    origin *origin
 }
 
 func (p process) arity() int {
     return len(p.args)
 }
 
+// builtins and foreign procedures, see builtins.go
 func (p process) isPredefined() bool {
-    // only predefined functors for now
-    return p.functor == ":=" || p.functor == "isplus" || p.functor == "is"
+    _, ok := lookupBuiltin(procKey{p.functor, p.arity()})
+    return ok
 }
 
 func (p process) isInfix() bool {
@@ -83,6 +127,9 @@ func (p process) String() string {
     if p.isInfix() && len(args) == 2 {
         return fmt.Sprintf("%s %s %s", args[0], p.functor, args[1])
     }
+    if len(args) == 0 {
+        return p.functor
+    }
     return fmt.Sprintf("%s(%s)", p.functor, strings.Join(args, ","))
 }
 
@@ -90,6 +137,8 @@ type rule struct {
     head process
     guard []guard
     body []process
+    // position among the rules for the same functor/arity, set by the index
+    clause int
 }
 
 func (r rule) String() string {
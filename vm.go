@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// engine selects how non-builtin processes are reduced
+type engine uint8
+
+const (
+	// reduce: copy the rule with fresh variables and cmatch the AST
+	astEngine engine = iota
+	// vmReduce: run the compiled procedure
+	vmEngine
+)
+
+// reduceProcess reduces p with whichever engine the interpreter was set to use
+// worker identifies the routine doing the work in trace events, where
+// 0 is the main interpreter routine and workers are numbered from 1
+func (i *Interpreter) reduceProcess(worker int, b bindings, p process) (bool, bindings, rule, []variable, attempt) {
+	if i.labels != nil {
+		i.labels.enter(p)
+		defer i.labels.leave()
+	}
+	a := attempt{worker: worker}
+	if i.tracer != nil {
+		a.start = time.Now()
+	}
+	var ok bool
+	var theta bindings
+	var r1 rule
+	var suspendOn []variable
+	if i.engine == vmEngine {
+		ok, theta, r1, suspendOn = i.vmReduce(b, p)
+	} else {
+		rules := i.getPossibleRules(b, p)
+		ok, theta, r1, suspendOn = i.reduce(b, p, rules)
+	}
+	if i.tracer != nil {
+		a.duration = time.Since(a.start)
+	}
+	return ok, theta, r1, suspendOn, a
+}
+
+// vmReduce is the compiled counterpart of reduce and returns the same:
+// success, bindings to commit, the rule that committed instantiated for p
+// and which vars to suspend on if any.
+// Since head variables live in registers there is never anything to bind.
+func (i *Interpreter) vmReduce(b bindings, p process) (bool, bindings, rule, []variable) {
+	proc, ok := i.code[procKey{p.functor, p.arity()}]
+	if !ok {
+		return false, nil, rule{}, nil
+	}
+	// the table is shared between workers, so shuffle a copy
+	clauses := append([]int(nil), proc.switchOnType(b, p)...)
+	rand.Shuffle(len(clauses), func(i, j int) {
+		clauses[i], clauses[j] = clauses[j], clauses[i]
+	})
+	if i.replayer != nil {
+		if c, ok := i.replayer.forcedClause(p); ok {
+			for n, k := range clauses {
+				if k == c {
+					clauses[0], clauses[n] = clauses[n], clauses[0]
+				}
+			}
+		}
+	}
+	m := map[variable]struct{}{}
+	for _, k := range clauses {
+		c := proc.clauses[k]
+		var start time.Time
+		if i.profiler != nil {
+			start = time.Now()
+		}
+		r1, ok, suspendOn := i.run(b, p, proc.code, c)
+		if i.profiler != nil {
+			i.profiler.record(c.rule, ok, suspendOn, time.Since(start))
+		}
+		if i.clauseHook != nil {
+			i.clauseHook(c.rule, ok, suspendOn)
+		}
+		if ok {
+			return true, bindings{}, r1, nil
+		}
+		for _, v := range suspendOn {
+			m[v] = struct{}{}
+		}
+	}
+	var suspend []variable
+	for k := range m {
+		suspend = append(suspend, k)
+	}
+	return false, nil, rule{}, suspend
+}
+
+func (c *compiledProc) switchOnType(b bindings, p process) []int {
+	table := c.code[0].table
+	if p.arity() == 0 {
+		return table.all
+	}
+	key, ok := firstArgKey(walk(b, p.args[0]))
+	if !ok {
+		return table.all
+	}
+	if clauses, ok := table.byFirstArg[key]; ok {
+		return clauses
+	}
+	return table.varFirstArg
+}
+
+// run executes a single clause. It returns the clause instantiated for p
+// on success, or on failure the variables to suspend on, if any.
+// Like cmatchGuards, it collects every variable the head suspends on before
+// giving up, and if the head matches, every one the guards suspend on.
+func (i *Interpreter) run(b bindings, p process, code []instr, c compiledClause) (rule, bool, []variable) {
+	regs := make([]expression, c.nregs)
+	copy(regs, p.args)
+	var body []process
+	var suspend []variable
+	inHead := true
+	for pc := c.entry; ; pc++ {
+		in := code[pc]
+		if inHead && !in.op.isGet() {
+			inHead = false
+			if len(suspend) > 0 {
+				return rule{}, false, suspend
+			}
+		}
+		switch in.op {
+		case opGetValue:
+			ok, sus := vmEqual(b, regs[in.a], regs[in.b])
+			if !ok {
+				if len(sus) == 0 {
+					return rule{}, false, nil
+				}
+				suspend = append(suspend, sus...)
+			}
+		case opGetConst:
+			x := walk(b, regs[in.a])
+			if v, ok := x.(variable); ok {
+				suspend = append(suspend, v)
+				continue
+			}
+			if x != in.k && x != underscore {
+				return rule{}, false, nil
+			}
+		case opGetList:
+			x := walk(b, regs[in.a])
+			switch t := x.(type) {
+			case variable:
+				// match the rest of the head against anything, like unify does
+				suspend = append(suspend, t)
+				regs[in.b], regs[in.c] = underscore, underscore
+			case list:
+				regs[in.b], regs[in.c] = t.head, t.tail
+			default:
+				if x != underscore {
+					return rule{}, false, nil
+				}
+				regs[in.b], regs[in.c] = underscore, underscore
+			}
+		case opGetStruct:
+			x := walk(b, regs[in.a])
+			switch t := x.(type) {
+			case variable:
+				suspend = append(suspend, t)
+				regs[in.b] = underscore
+			case compound:
+				if t.functor != in.s {
+					return rule{}, false, nil
+				}
+				regs[in.b] = t.args
+			default:
+				if x != underscore {
+					return rule{}, false, nil
+				}
+				regs[in.b] = underscore
+			}
+		case opPutConst:
+			regs[in.a] = in.k
+		case opPutVar:
+			regs[in.a] = i.fresh()
+		case opPutList:
+			regs[in.a] = list{head: regs[in.b], tail: regs[in.c]}
+		case opPutStruct:
+			regs[in.a] = compound{functor: in.s, args: regs[in.b]}
+		case opGuard:
+			ok, sus := guardMatch(b, bindings{}, guard{operator: in.s, args: []expression{regs[in.a], regs[in.b]}})
+			if !ok {
+				if len(sus) == 0 {
+					// this guard can never succeed, so neither can the rule
+					return rule{}, false, nil
+				}
+				suspend = append(suspend, sus...)
+			}
+		case opCommit:
+			if len(suspend) > 0 {
+				return rule{}, false, suspend
+			}
+		case opSpawn:
+			args := make([]expression, len(in.regs))
+			for n, r := range in.regs {
+				args[n] = regs[r]
+			}
+			body = append(body, process{functor: in.s, args: args})
+		case opProceed:
+			return c.instantiate(regs, body), true, nil
+		default:
+			panic(fmt.Sprintf("unexpected instruction %s", in))
+		}
+	}
+}
+
+// instantiate returns the clause with every variable replaced by what its
+// register holds, like freshCopy does, and body as its spawned body
+func (c compiledClause) instantiate(regs []expression, body []process) rule {
+	var subst func(e expression) expression
+	subst = func(e expression) expression {
+		switch t := e.(type) {
+		case variable:
+			return regs[c.vars[t]]
+		case list:
+			return list{head: subst(t.head), tail: subst(t.tail)}
+		case compound:
+			return compound{functor: t.functor, args: subst(t.args)}
+		}
+		return e
+	}
+	head := process{functor: c.rule.head.functor, args: make([]expression, c.rule.head.arity())}
+	for n, arg := range c.rule.head.args {
+		head.args[n] = subst(arg)
+	}
+	var guards []guard
+	for _, g := range c.rule.guard {
+		guards = append(guards, guard{operator: g.operator, args: []expression{subst(g.args[0]), subst(g.args[1])}})
+	}
+	return rule{head: head, guard: guards, body: body, clause: c.rule.clause}
+}
+
+// head variables occurring twice have to be equal;
+// an unbound variable on either side means we have to suspend
+func vmEqual(b bindings, u, v expression) (bool, []variable) {
+	u, v = walk(b, u), walk(b, v)
+	if u == v || u == underscore || v == underscore {
+		return true, nil
+	}
+	var suspend []variable
+	if uvar, ok := u.(variable); ok {
+		suspend = append(suspend, uvar)
+	}
+	if vvar, ok := v.(variable); ok {
+		suspend = append(suspend, vvar)
+	}
+	if len(suspend) > 0 {
+		return false, suspend
+	}
+	uComp, uIsComp := u.(compound)
+	vComp, vIsComp := v.(compound)
+	if uIsComp && vIsComp {
+		if uComp.functor != vComp.functor {
+			return false, nil
+		}
+		return vmEqual(b, uComp.args, vComp.args)
+	}
+	uList, uIsList := u.(list)
+	vList, vIsList := v.(list)
+	if uIsList && vIsList {
+		okh, sush := vmEqual(b, uList.head, vList.head)
+		okt, sust := vmEqual(b, uList.tail, vList.tail)
+		if okh && okt {
+			return true, nil
+		}
+		if (!okh && len(sush) == 0) || (!okt && len(sust) == 0) {
+			return false, nil
+		}
+		return false, append(sush, sust...)
+	}
+	return false, nil
+}